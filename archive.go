@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// archiveLogs is the 'archive' command: it moves the story logs and html
+// pages to archive.<date>/ in progDir, so the logs don't grow forever;
+// processed IDs, pending stories and the digest feed stay, so archived
+// stories aren't shown again
+func archiveLogs(c cli, args []string) {
+	if len(args) > 0 {
+		errExit(errors.New(args[0]), "error: unexpected arguments")
+	}
+
+	dir := c.progDir + "archive." + c.clk.Now().Format("2006-01-02") + "/"
+	_, err := os.Stat(dir)
+	if err == nil {
+		errExit(errors.New(dir), "error: archive already exists")
+	}
+
+	var files []string
+	for _, source := range registeredSources {
+		for _, bucket := range []string{"main", "blocked", "permalow"} {
+			files = append(files, source.Name()+"_"+bucket+".tsv")
+		}
+	}
+	for _, pattern := range []string{"news_*.html", "blocked_*.html"} {
+		matches, err := filepath.Glob(c.progDir + pattern)
+		errExit(err, "error: cannot list files")
+		for _, m := range matches {
+			files = append(files, filepath.Base(m))
+		}
+	}
+
+	err = os.Mkdir(dir, 0755)
+	errExit(err, "error: cannot create dir")
+
+	for _, file := range files {
+		err = os.Rename(c.progDir+file, dir+file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		errExit(err, "error: cannot move file")
+		info("%s\n", dir+file)
+	}
+}
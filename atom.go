@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+)
+
+// accepted stories of every run are appended to digest.tsv together with
+// the time they were accepted; the last 'feed_entries' of them are written
+// to newsfilter.atom and newsfilter.rss when 'atom' or 'rss' are in the
+// 'outputs' setting
+type digestEntry struct {
+	accepted time.Time
+	story    newsStory
+}
+
+type atomFeed struct {
+	XMLName xml.Name       `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string         `xml:"id"`
+	Title   string         `xml:"title"`
+	Updated string         `xml:"updated"`
+	Author  atomAuthor     `xml:"author"`
+	Entries []atomOutEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomOutEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     *atomAuthor    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title         string       `xml:"title"`
+		Link          string       `xml:"link"`
+		Description   string       `xml:"description"`
+		LastBuildDate string       `xml:"lastBuildDate"`
+		Items         []rssOutItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssOutItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Guid        rssGuid  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Comments    string   `xml:"comments,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGuid struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// prepareFeeds adds the accepted stories to digest.tsv and writes the
+// enabled feed formats
+func prepareFeeds(all []*results, settings config, progDir string,
+	now time.Time) {
+
+	outputs := settings.outputs()
+	if !strIn(outputs, "atom") && !strIn(outputs, "rss") {
+		return
+	}
+
+	max := settings.feedEntries()
+
+	// a page accepted from more than one source is added only once
+	entries := readDigest(progDir)
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		seen[canonicalUrl(e.story.Url)] = true
+	}
+	for _, res := range all {
+		for _, story := range res.stories["main"] {
+			u := canonicalUrl(story.Url)
+			if u != "" && seen[u] {
+				continue
+			}
+			seen[u] = true
+			entries = append(entries, digestEntry{now, story})
+		}
+	}
+	if len(entries) > max {
+		entries = entries[len(entries)-max:]
+	}
+	writeDigest(progDir, entries)
+
+	// newest entries first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	if strIn(outputs, "atom") {
+		writeXml(progDir+"newsfilter.atom", atomDigest(entries, now))
+	}
+	if strIn(outputs, "rss") {
+		writeXml(progDir+"newsfilter.rss", rssDigest(entries, now))
+	}
+}
+
+func readDigest(progDir string) []digestEntry {
+	var entries []digestEntry
+
+	fd, err := os.Open(progDir + "digest.tsv")
+	if err != nil {
+		return entries
+	}
+	defer fd.Close()
+
+	input := bufio.NewScanner(fd)
+	for input.Scan() {
+		s := strings.SplitN(input.Text(), "\t", 3)
+		if len(s) < 3 {
+			errExit(fmt.Errorf("%s", input.Text()),
+				"error: cannot parse digest.tsv")
+		}
+
+		t, err := time.Parse(time.RFC3339, s[0])
+		errExit(err, "error: cannot parse digest.tsv")
+		story, err := parseLogLine(s[1], s[2])
+		errExit(err, "error: cannot parse digest.tsv")
+
+		entries = append(entries, digestEntry{t, story})
+	}
+
+	return entries
+}
+
+func writeDigest(progDir string, entries []digestEntry) {
+	fdOpts := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	fd, err := os.OpenFile(progDir+"digest.tsv", fdOpts, 0644)
+	errExit(err, "error: cannot create file")
+	defer fd.Close()
+
+	for _, e := range entries {
+		fmt.Fprintf(fd, "%s\t%s\t%s\n", e.accepted.Format(time.RFC3339),
+			e.story.Source, logLine(e.story))
+	}
+}
+
+// entryID is stable across runs, e.g. 'urn:newsfilter:hn:29750000' or
+// 'urn:newsfilter:lrs:abc123'
+func entryID(story newsStory) string {
+	return "urn:newsfilter:" + story.Source + ":" + story.ID
+}
+
+// entrySummary leaves out comment counts, as they aren't logged in
+// digest.tsv; the summary is html, so the domain and the comments url,
+// which come from the sources as they are, get escaped
+func entrySummary(story newsStory) string {
+	domain := html.EscapeString(story.Domain)
+
+	summary := domain
+	if story.Score > 0 {
+		summary = fmt.Sprintf("%d points, %s", story.Score, domain)
+	}
+	if story.CommentsUrl != "" {
+		summary += fmt.Sprintf(", <a href=\"%s\">comments</a>",
+			html.EscapeString(story.CommentsUrl))
+	}
+	return summary
+}
+
+func atomDigest(entries []digestEntry, now time.Time) atomFeed {
+	feed := atomFeed{
+		ID:      "urn:newsfilter:digest",
+		Title:   "newsfilter",
+		Updated: now.Format(time.RFC3339),
+		Author:  atomAuthor{Name: "newsfilter"},
+	}
+
+	for _, e := range entries {
+		story := e.story
+		entry := atomOutEntry{
+			ID:        entryID(story),
+			Title:     story.Title,
+			Link:      atomLink{Href: story.Url},
+			Updated:   e.accepted.Format(time.RFC3339),
+			Published: story.Time.Format(time.RFC3339),
+			Content:   atomContent{"html", entrySummary(story)},
+		}
+		if story.By != "" {
+			entry.Author = &atomAuthor{Name: story.By}
+		}
+		for _, t := range append([]string{story.Source}, story.Tags...) {
+			entry.Categories = append(entry.Categories,
+				atomCategory{Term: t})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return feed
+}
+
+func rssDigest(entries []digestEntry, now time.Time) rssFeed {
+	var feed rssFeed
+
+	feed.Version = "2.0"
+	feed.Channel.Title = "newsfilter"
+	feed.Channel.Link = "https://github.com/h1xxx/newsfilter"
+	feed.Channel.Description = "filtered tech news"
+	feed.Channel.LastBuildDate = now.Format(time.RFC1123Z)
+
+	for _, e := range entries {
+		story := e.story
+		item := rssOutItem{
+			Title:       story.Title,
+			Link:        story.Url,
+			Guid:        rssGuid{"false", entryID(story)},
+			PubDate:     e.accepted.Format(time.RFC1123Z),
+			Comments:    story.CommentsUrl,
+			Categories:  append([]string{story.Source}, story.Tags...),
+			Description: entrySummary(story),
+		}
+
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	return feed
+}
+
+// writeXml writes to a temporary file first, so feed readers never get a
+// partially written feed
+func writeXml(file string, v interface{}) {
+	b, err := xml.MarshalIndent(v, "", "\t")
+	errExit(err, "error: cannot prepare "+file)
+
+	b = append([]byte(xml.Header), b...)
+	err = os.WriteFile(file+".new", append(b, '\n'), 0644)
+	errExit(err, "error: cannot create file")
+
+	err = os.Rename(file+".new", file)
+	errExit(err, "error: cannot create file")
+}
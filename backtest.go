@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// listFlag is a flag that can be given many times
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// backtestChange is a logged story whose verdict differs between the
+// current and the proposed blocklists
+type backtestChange struct {
+	story  newsStory
+	bucket string
+	r      reason
+}
+
+// backtestRules is 'rules backtest': every story logged to the main, blocked
+// and permalow logs, also the archived ones, is checked against the current
+// and the proposed blocklists; the stories that would newly be blocked are
+// printed grouped by the proposed rule, the ones that would pass again
+// grouped by the current rule
+func backtestRules(c cli, args []string) {
+	fs := flag.NewFlagSet("rules backtest", flag.ExitOnError)
+	domains := fs.String("domains", c.progDir+"blocked.domains",
+		"proposed blocked.domains")
+	keywords := fs.String("keywords", c.progDir+"blocked.keywords",
+		"proposed blocked.keywords")
+	users := fs.String("users", c.progDir+"blocked.users",
+		"proposed blocked.users")
+	var addDomains, addKeywords listFlag
+	fs.Var(&addDomains, "domain", "domain added to the proposed "+
+		"blocked.domains, can be repeated")
+	fs.Var(&addKeywords, "keyword", "line added to the proposed "+
+		"blocked.keywords, e.g. 'i:w:rust\t!Rust Belt', can be repeated")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		errExit(errors.New(fs.Arg(0)), "error: unexpected arguments")
+	}
+
+	conf := readClassRules(c.progDir)
+	current := readBlocklists(c.progDir)
+	proposed := readBlocklistFiles(*domains, *keywords, *users)
+
+	n := countLines(*domains)
+	for _, d := range addDomains {
+		n++
+		proposed.domains = append(proposed.domains,
+			listEntry{line: n, text: normalizeDomainEntry(d)})
+	}
+
+	var entries []listEntry
+	n = countLines(*keywords)
+	for _, k := range addKeywords {
+		n++
+		entries = append(entries, listEntry{line: n, text: k})
+	}
+	rules, errs := parseKeywords(entries)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println("-keyword:" + err.Error())
+		}
+		errExit(errors.New("-keyword"), "error: incorrect rules")
+	}
+	for _, rule := range rules {
+		if rule.tag {
+			proposed.tags = append(proposed.tags, rule)
+		} else {
+			proposed.keywords = append(proposed.keywords, rule)
+		}
+	}
+
+	dirs := []string{c.progDir}
+	archives, err := filepath.Glob(c.progDir + "archive.*")
+	errExit(err, "error: cannot list archives")
+	for _, a := range archives {
+		dirs = append(dirs, a+"/")
+	}
+
+	var blocked, unblocked []backtestChange
+	total := 0
+	for _, dir := range dirs {
+		for _, source := range registeredSources {
+			name := source.Name()
+			for _, bucket := range []string{"main", "blocked",
+				"permalow"} {
+
+				file := name + "_" + bucket + ".tsv"
+				for _, story := range readLog(dir, name, file) {
+					// stories rejected by the source itself
+					// don't depend on any blocklist
+					if story.Reason.bucket == "blocked" &&
+						story.Reason.file == "" {
+						continue
+					}
+					total++
+
+					in := ruleInput{
+						title:  story.Title,
+						domain: story.Domain,
+						author: story.By,
+						score:  story.Score,
+						age:    story.Hours,
+						tags:   story.Tags,
+					}
+					was, rc := blockReason(name, in, current,
+						conf, nil)
+					is, rp := blockReason(name, in, proposed,
+						conf, nil)
+
+					switch {
+					case is && !was:
+						blocked = append(blocked,
+							backtestChange{story, bucket, rp})
+					case was && !is:
+						unblocked = append(unblocked,
+							backtestChange{story, bucket, rc})
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Printf("%d stories replayed from %d dirs\n", total, len(dirs))
+	printBacktest("newly blocked", blocked)
+	printBacktest("unblocked", unblocked)
+}
+
+// printBacktest prints the changes grouped by rule, the rules that change
+// the most stories first
+func printBacktest(title string, changes []backtestChange) {
+	fmt.Printf("\n%s: %d\n", title, len(changes))
+
+	groups := make(map[string][]backtestChange)
+	var rules []string
+	for _, ch := range changes {
+		rule := reasonString(ch.r)
+		if _, ok := groups[rule]; !ok {
+			rules = append(rules, rule)
+		}
+		groups[rule] = append(groups[rule], ch)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := groups[rules[i]], groups[rules[j]]
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return rules[i] < rules[j]
+	})
+
+	for _, rule := range rules {
+		fmt.Printf("\n  %s: %d\n", rule, len(groups[rule]))
+		for _, ch := range groups[rule] {
+			s := ch.story
+			fmt.Printf("    %s %s %s  %s (%s)\n", s.Source, ch.bucket,
+				s.ID, s.Title, s.Domain)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	neturl "net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that don't change the page; a name
+// ending with '*' is a prefix
+var trackingParams = []string{"utm_*", "ref", "ref_src", "ref_url",
+	"fbclid", "gclid", "dclid", "msclkid", "yclid", "igshid", "mc_cid",
+	"mc_eid", "_ga", "_hsenc", "_hsmi", "mkt_tok", "amp", "outputType"}
+
+// mobileLabels are subdomains of mobile and AMP versions of a site, e.g.
+// en.m.wikipedia.org or amp.theguardian.com
+var mobileLabels = []string{"www", "m", "mobile", "amp"}
+
+// canonicalUrl returns the form of an url used to tell if two urls are the
+// same page: https, lowercase host without www. and mobile or AMP
+// subdomains, no userinfo, default port, fragment, tracking parameters and
+// trailing '/'; Google AMP cache urls are mapped to the page
+func canonicalUrl(rawUrl string) string {
+	return canonicalAmpUrl(rawUrl, false)
+}
+
+// canonicalAmpUrl is canonicalUrl that also drops a trailing /amp of the
+// path if the url is known to be an AMP page: it came from the AMP cache, it
+// has an amp subdomain or an amp=1 or outputType=amp parameter; elsewhere
+// /amp is part of the page, e.g. github.com/ampproject/amp
+func canonicalAmpUrl(rawUrl string, amp bool) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	u, err := neturl.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return rawUrl
+	}
+
+	host := normalizeHost(u.Hostname())
+	path := u.EscapedPath()
+
+	// e.g. www.google.com/amp/s/example.com/post or
+	// example-com.cdn.ampproject.org/c/s/example.com/post
+	ampCache := host == "google.com" ||
+		strings.HasSuffix(host, ".google.com") ||
+		strings.HasSuffix(host, ".cdn.ampproject.org")
+	for _, prefix := range []string{"/amp/s/", "/c/s/", "/v/s/"} {
+		if ampCache && strings.HasPrefix(path, prefix) {
+			target := "https://" + strings.TrimPrefix(path, prefix)
+			if u.RawQuery != "" {
+				target += "?" + u.RawQuery
+			}
+			return canonicalAmpUrl(target, true)
+		}
+	}
+
+	site := registrableDomain(host)
+	if site != "" && site != host {
+		labels := strings.Split(strings.TrimSuffix(host, "."+site), ".")
+		var keep []string
+		for _, l := range labels {
+			if l == "amp" {
+				amp = true
+			}
+			if !strIn(mobileLabels, l) {
+				keep = append(keep, l)
+			}
+		}
+		host = strings.Join(append(keep, site), ".")
+	}
+
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") ||
+		(u.Scheme == "https" && port == "443") {
+
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+
+	query := u.Query()
+	if _, ok := query["amp"]; ok || query.Get("outputType") == "amp" {
+		amp = true
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	if amp {
+		path = strings.TrimSuffix(path, "/amp")
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	for name := range query {
+		if isTrackingParam(name) {
+			query.Del(name)
+		}
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "http" {
+		scheme = "https"
+	}
+
+	res := scheme + "://" + host + path
+	if len(query) > 0 {
+		res += "?" + query.Encode()
+	}
+	// hashbang fragments are paths of single-page sites
+	if strings.HasPrefix(u.Fragment, "!") {
+		res += "#" + u.EscapedFragment()
+	}
+
+	return res
+}
+
+func isTrackingParam(name string) bool {
+	for _, p := range trackingParams {
+		if strings.HasSuffix(p, "*") &&
+			strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+
+			return true
+		}
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
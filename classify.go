@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// classConfig is the parsed classify.rules: ordered rules for every source
+// and the kinds of blocklist rules each source has opted into
+type classConfig struct {
+	rules   []classRule
+	filters map[string][]string
+}
+
+// classRule is a single line of classify.rules; a story lands in the bucket
+// of the first rule of its source whose condition matches, or in 'main' if
+// there's none
+type classRule struct {
+	line   int
+	source string
+	bucket string
+	text   string
+
+	// alternatives joined with '||', each a list of comparisons joined
+	// with '&&'; no alternatives means the rule always matches
+	any [][]comparison
+}
+
+type comparison struct {
+	field string
+	op    string
+	value int
+}
+
+var classFields = []string{"hours", "score", "comments", "scoreavg"}
+
+// stories in the 'low' bucket aren't marked as processed, so they're
+// classified again on the next run
+var classBuckets = []string{"main", "blocked", "permalow", "low"}
+
+var classOps = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// kinds of blocklist rules that can be enabled per source with a 'filter'
+// line; 'keywords' are title and expr: lines of blocked.keywords, 'tags' are
+// its tag: lines
+var classFilters = []string{"domains", "users", "keywords", "tags"}
+
+// defaultClassRules is the classify.rules file shipped in the repo, used
+// when there's no classify.rules file in progDir
+//
+//go:embed classify.rules
+var defaultClassRules string
+
+func readClassRules(progDir string) classConfig {
+	text := defaultClassRules
+
+	b, err := os.ReadFile(progDir + "classify.rules")
+	if err == nil {
+		text = string(b)
+	} else if !os.IsNotExist(err) {
+		errExit(err, "error: cannot read file")
+	}
+
+	conf, err := parseClassRules(text)
+	errExit(err, "error: incorrect rule in classify.rules")
+
+	return conf
+}
+
+func parseClassRules(text string) (classConfig, error) {
+	var rules []classRule
+	defaults := make(map[string]int)
+	filters := make(map[string][]string)
+
+	input := bufio.NewScanner(strings.NewReader(text))
+	for i := 1; input.Scan(); i++ {
+		line := strings.TrimSpace(input.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == "filter" {
+			err := parseFilter(fields, filters)
+			if err != nil {
+				return classConfig{}, fmt.Errorf("line %d: %s: %v",
+					i, line, err)
+			}
+			continue
+		}
+
+		rule, err := parseClassRule(line)
+		if err != nil {
+			return classConfig{}, fmt.Errorf("line %d: %s: %v",
+				i, line, err)
+		}
+		rule.line = i
+
+		if d, ok := defaults[rule.source]; ok {
+			return classConfig{}, fmt.Errorf("line %d: %s: "+
+				"unreachable, 'default' rule for %s already on "+
+				"line %d", i, line, rule.source, d)
+		}
+		if rule.any == nil {
+			defaults[rule.source] = i
+		}
+
+		rules = append(rules, rule)
+	}
+
+	for _, source := range registeredSources {
+		if _, ok := filters[source.Name()]; !ok {
+			filters[source.Name()] = source.Filters()
+		}
+	}
+
+	return classConfig{rules: rules, filters: filters}, nil
+}
+
+func parseFilter(fields []string, filters map[string][]string) error {
+	source := fields[0]
+	if _, ok := sourceByName(source); !ok {
+		return fmt.Errorf("unknown source '%s'", source)
+	}
+	if _, ok := filters[source]; ok {
+		return fmt.Errorf("filter for %s already set", source)
+	}
+
+	filters[source] = []string{}
+	for _, f := range fields[2:] {
+		if !strIn(classFilters, f) {
+			return fmt.Errorf("unknown blocklist rules '%s'", f)
+		}
+		filters[source] = append(filters[source], f)
+	}
+
+	return nil
+}
+
+// filtersOn reports if the source has opted into the kind of blocklist rules
+func (conf classConfig) filtersOn(source, kind string) bool {
+	return strIn(conf.filters[source], kind)
+}
+
+func parseClassRule(line string) (classRule, error) {
+	var rule classRule
+
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return rule, fmt.Errorf("expected: source bucket condition")
+	}
+
+	rule.source = fields[0]
+	rule.bucket = fields[1]
+	rule.text = strings.Join(fields[2:], " ")
+
+	if _, ok := sourceByName(rule.source); !ok {
+		return rule, fmt.Errorf("unknown source '%s'", rule.source)
+	}
+	if !strIn(classBuckets, rule.bucket) {
+		return rule, fmt.Errorf("unknown bucket '%s'", rule.bucket)
+	}
+
+	if rule.text == "default" {
+		return rule, nil
+	}
+
+	for _, alt := range strings.Split(rule.text, "||") {
+		var all []comparison
+		for _, c := range strings.Split(alt, "&&") {
+			cmp, err := parseComparison(strings.TrimSpace(c))
+			if err != nil {
+				return rule, err
+			}
+			if !strIn(classFields, cmp.field) {
+				return rule, fmt.Errorf("unknown field '%s'",
+					cmp.field)
+			}
+			all = append(all, cmp)
+		}
+		rule.any = append(rule.any, all)
+	}
+
+	return rule, nil
+}
+
+func parseComparison(s string) (comparison, error) {
+	for _, op := range classOps {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+
+		field := strings.TrimSpace(s[:i])
+		value, err := strconv.Atoi(strings.TrimSpace(s[i+len(op):]))
+		if err != nil || field == "" {
+			return comparison{}, fmt.Errorf(
+				"expected: field %s number, got '%s'", op, s)
+		}
+
+		return comparison{field: field, op: op, value: value}, nil
+	}
+
+	return comparison{}, fmt.Errorf("no comparison operator in '%s'", s)
+}
+
+// matchClassRule returns the first rule of the source matching the story
+// fields
+func matchClassRule(conf classConfig, source string, fields map[string]int,
+	t *tracer) classRule {
+
+	t.printf("classify.rules:\n")
+	for _, rule := range conf.rules {
+		if rule.source != source {
+			continue
+		}
+		if rule.matches(fields) {
+			t.printf("  line %d '%s %s': yes\n", rule.line,
+				rule.bucket, rule.text)
+			return rule
+		}
+		t.printf("  line %d '%s %s': no\n", rule.line, rule.bucket,
+			rule.text)
+	}
+
+	return classRule{source: source, bucket: "main", text: "default"}
+}
+
+func (rule classRule) matches(fields map[string]int) bool {
+	if rule.any == nil {
+		return true
+	}
+
+	for _, all := range rule.any {
+		ok := true
+		for _, c := range all {
+			if !c.matches(fields[c.field]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c comparison) matches(v int) bool {
+	switch c.op {
+	case ">=":
+		return v >= c.value
+	case "<=":
+		return v <= c.value
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case ">":
+		return v > c.value
+	case "<":
+		return v < c.value
+	}
+	return false
+}
+
+func strIn(s []string, el string) bool {
+	for _, e := range s {
+		if e == el {
+			return true
+		}
+	}
+	return false
+}
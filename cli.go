@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cli holds what every command needs: the data dir, the settings with all
+// the flags applied and the clock of the run
+type cli struct {
+	progDir  string
+	settings config
+	clk      clock
+}
+
+// command is a subcommand of newsfilter; commands with subcommands of their
+// own, like 'rules', parse the rest of args themselves
+type command struct {
+	name string
+	args string
+	help string
+	run  func(c cli, args []string)
+}
+
+var commands []command
+
+// verbosity is 0 with -q, 2 with -v and 1 otherwise
+var verbosity = 1
+
+func init() {
+	commands = []command{
+		{"run", "", "fetch, filter and log new stories, write the " +
+			"outputs (default)", runNews},
+		{"explain", "[flags] <hn-id|url|title>", "print why a story " +
+			"goes to its bucket, see 'newsfilter explain -h'",
+			explainStory},
+		{"blocked", "", "write an html page with blocked stories",
+			func(c cli, args []string) {
+				reportBlocked(c.progDir, c.settings, c.clk.Now())
+			}},
+		{"stats", "[users [min_stories]]", "print the number of " +
+			"logged stories, or per-submitter stats of HN stories",
+			reportStats},
+		{"users", "[min_stories]", "per-submitter stats of HN " +
+			"stories, the same as 'stats users'",
+			func(c cli, args []string) {
+				reportUsers(c.progDir, args)
+			}},
+		{"rules", "test [file] | backtest [flags] | lint [flags]",
+			"check the blocklists against the cases in rules.tests, " +
+				"replay the logs through proposed blocklists, or " +
+				"find useless and malformed lines of the blocklists",
+			rulesCommand},
+		{"archive", "", "move the logs and html pages to " +
+			"archive.<date>/", archiveLogs},
+		{"serve", "[address]", "serve the html pages and feeds, " +
+			"localhost:8080 by default", serveDigest},
+	}
+}
+
+// parseFlags parses the global flags, which go before the command, and
+// returns the remaining args
+func parseFlags() (cli, []string) {
+	var c cli
+
+	homeDir, err := os.UserHomeDir()
+	errExit(err, "error: cannot get home dir")
+
+	dir := flag.String("dir", homeDir+"/.local/share/newsfilter",
+		"data dir with the blocklists and logs")
+	confFile := flag.String("config", "", "config file, "+
+		"newsfilter.conf in the data dir by default")
+	sources := flag.String("sources", "", "comma-separated sources, "+
+		"overrides sources in the config file")
+	outputs := flag.String("outputs", "", "comma-separated output "+
+		"formats, overrides outputs in the config file")
+	verbose := flag.Bool("v", false, "print every story and retry")
+	quiet := flag.Bool("q", false, "print only errors and output files")
+	urls := urlFlags()
+	now := flag.String("now", "", "time of the run, e.g. "+
+		"'2026-10-01 08:00', to replay a past run")
+	tz := flag.String("timezone", "", "timezone, overrides "+
+		"timezone in the config file")
+	flag.Usage = usage
+	flag.Parse()
+
+	c.progDir = strings.TrimSuffix(*dir, "/") + "/"
+	if *confFile == "" {
+		*confFile = c.progDir + "newsfilter.conf"
+	} else {
+		_, err = os.Stat(*confFile)
+		errExit(err, "error: cannot read config file")
+	}
+
+	switch {
+	case *verbose && *quiet:
+		errExit(errors.New("-v and -q"), "error: conflicting flags")
+	case *verbose:
+		verbosity = 2
+	case *quiet:
+		verbosity = 0
+	}
+
+	c.settings = readConfig(*confFile)
+	c.settings.setUrls(urls)
+	c.settings.setPathDomains()
+	if *sources != "" {
+		c.settings["sources"] = strings.Split(*sources, ",")
+	}
+	if *outputs != "" {
+		c.settings["outputs"] = strings.Split(*outputs, ",")
+	}
+	if *tz != "" {
+		c.settings["timezone"] = []string{*tz}
+	}
+	c.clk = newClock(c.settings, *now)
+
+	return c, flag.Args()
+}
+
+func runCommand(c cli, args []string) {
+	if len(args) == 0 {
+		runNews(c, nil)
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			cmd.run(c, args[1:])
+			return
+		}
+	}
+
+	errExit(errors.New(args[0]), "error: unknown command, see "+
+		"'newsfilter -h'")
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprint(out, "usage: newsfilter [flags] [command [args]]\n\n"+
+		"commands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %s %s\n\t%s\n", cmd.name, cmd.args,
+			cmd.help)
+	}
+	fmt.Fprint(out, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// info prints progress messages, unless -q is set
+func info(format string, a ...interface{}) {
+	if verbosity >= 1 {
+		fmt.Printf(format, a...)
+	}
+}
+
+// debug prints details of every story and request with -v
+func debug(format string, a ...interface{}) {
+	if verbosity >= 2 {
+		fmt.Printf(format, a...)
+	}
+}
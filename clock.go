@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// clock is where the time of a run comes from; ages of stories, names of
+// the html files and times in the feeds are all counted from clock.Now(), so
+// with a fixed clock a past run can be replayed exactly
+type clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now().In(location)
+}
+
+type fixedClock struct {
+	t time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.t
+}
+
+// location is the timezone of all the logged and printed times, set by
+// newClock from the 'timezone' setting
+var location = time.Local
+
+// layouts accepted by -now; a time without an offset is in the timezone from
+// the settings
+var nowLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// newClock sets the timezone and returns the system clock, or a clock fixed
+// at now if it's not empty
+func newClock(settings config, now string) clock {
+	loc, err := time.LoadLocation(settings.value("timezone"))
+	errExit(err, "error: incorrect timezone")
+	location = loc
+
+	if now == "" {
+		return systemClock{}
+	}
+
+	for _, layout := range nowLayouts {
+		t, err := time.ParseInLocation(layout, now, location)
+		if err == nil {
+			return fixedClock{t.In(location)}
+		}
+	}
+
+	errExit(errors.New(now), "error: incorrect time, expected e.g. "+
+		"'2026-10-01 08:00' or '2026-10-01T08:00:00Z'")
+	return nil
+}
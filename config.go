@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// config holds settings from the optional newsfilter.conf in progDir, or
+// the file set with -config; every line is a key followed by
+// whitespace-separated values, e.g.
+//
+//	sources	hn lrs
+type config map[string][]string
+
+// configKeys lists all the known settings with their default values
+var configKeys = map[string][]string{
+	"sources":           {"hn", "lrs", "feed", "reddit"},
+	"reddit_subreddits": {},
+	"reddit_listing":    {"top"},
+	"reddit_url":        {"https://www.reddit.com"},
+	"hn_api_url":        {"https://hacker-news.firebaseio.com/v0"},
+	"hn_url":            {"https://news.ycombinator.com"},
+	"lrs_url":           {"https://lobste.rs"},
+	"outputs":           {"html", "atom"},
+	"feed_entries":      {"200"},
+	"http_timeout":      {"30s"},
+	"http_retries":      {"3"},
+	"http_backoff":      {"1s"},
+	"http_failures":     {"50"},
+	"http_rate":         {"50"},
+	"http_workers":      {"16"},
+	"pending_tries":     {"5"},
+	"timezone":          {"Local"},
+	"path_domains":      defaultPathDomains,
+}
+
+// defaultPathDomains are hosts with many sites, told apart by a path or a
+// subdomain, see pathDomain
+var defaultPathDomains = []string{"github.com/*", "gitlab.com/*",
+	"codeberg.org/*", "sr.ht/~*", "medium.com/@*", "*.medium.com",
+	"*.substack.com", "substack.com/@*", "youtube.com/@*", "twitter.com/*",
+	"x.com/*"}
+
+// urlKeys are settings with base urls of the sites, so newsfilter can be
+// pointed to a local mirror or a fake server; each of them can be also set
+// with a flag, e.g. -hn-api-url, or an environment variable, e.g.
+// NEWSFILTER_HN_API_URL, which take precedence over newsfilter.conf
+var urlKeys = []string{"hn_api_url", "hn_url", "lrs_url", "reddit_url"}
+
+// base urls used all over the program, set by setUrls
+var hnApiUrl, hnUrl, lrsUrl string
+
+func readConfig(file string) config {
+	conf := make(config)
+
+	fd, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return conf
+	}
+	errExit(err, "error: cannot read file")
+	defer fd.Close()
+
+	input := bufio.NewScanner(fd)
+	for i := 1; input.Scan(); i++ {
+		fields := strings.Fields(input.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if _, ok := configKeys[fields[0]]; !ok {
+			msg := fmt.Sprintf("%s:%d: unknown setting", file, i)
+			errExit(errors.New(fields[0]), msg)
+		}
+		conf[fields[0]] = fields[1:]
+	}
+
+	return conf
+}
+
+func (conf config) list(key string) []string {
+	if v, ok := conf[key]; ok {
+		return v
+	}
+	return configKeys[key]
+}
+
+// value returns the first value of a setting
+func (conf config) value(key string) string {
+	v := conf.list(key)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+// outputs returns the enabled output formats
+func (conf config) outputs() []string {
+	for _, o := range conf.list("outputs") {
+		if !strIn([]string{"html", "atom", "rss"}, o) {
+			errExit(errors.New(o), "error: unknown output in "+
+				"newsfilter.conf, known outputs: html atom rss")
+		}
+	}
+	return conf.list("outputs")
+}
+
+// feedEntries returns the number of entries kept in the digest feeds
+func (conf config) feedEntries() int {
+	max, err := strconv.Atoi(conf.value("feed_entries"))
+	if err != nil || max < 1 {
+		errExit(fmt.Errorf("feed_entries: %s",
+			conf.value("feed_entries")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+	return max
+}
+
+// sources returns the enabled sources in the order of digest sections
+func (conf config) sources() []Source {
+	var res []Source
+
+	for _, name := range conf.list("sources") {
+		s, ok := sourceByName(name)
+		if !ok {
+			errExit(errors.New(name), "error: unknown source in "+
+				"newsfilter.conf, known sources: "+
+				strings.Join(sourceNames(), " "))
+		}
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// setPathDomains parses the path_domains setting, see pathDomain
+func (conf config) setPathDomains() {
+	pathDomains = nil
+	for _, v := range conf.list("path_domains") {
+		pd, err := parsePathDomain(v)
+		errExit(err, "error: incorrect path_domains in newsfilter.conf")
+		pathDomains = append(pathDomains, pd)
+	}
+}
+
+// urlFlags defines a flag for every setting in urlKeys
+func urlFlags() map[string]*string {
+	flags := make(map[string]*string)
+	for _, key := range urlKeys {
+		name := strings.Replace(key, "_", "-", -1)
+		flags[key] = flag.String(name, "", "base url, overrides "+key+
+			" in newsfilter.conf")
+	}
+	return flags
+}
+
+// setUrls applies the url flags and environment variables to the settings
+// and sets the base urls
+func (conf config) setUrls(flags map[string]*string) {
+	for _, key := range urlKeys {
+		env := os.Getenv("NEWSFILTER_" + strings.ToUpper(key))
+		if env != "" {
+			conf[key] = []string{env}
+		}
+		if *flags[key] != "" {
+			conf[key] = []string{*flags[key]}
+		}
+	}
+
+	hnApiUrl = strings.TrimSuffix(conf.value("hn_api_url"), "/")
+	hnUrl = strings.TrimSuffix(conf.value("hn_url"), "/")
+	lrsUrl = strings.TrimSuffix(conf.value("lrs_url"), "/")
+}
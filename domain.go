@@ -0,0 +1,377 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// public_suffix_list.dat is a copy of https://publicsuffix.org/list/, it
+// tells which part of a host is the registrable domain, e.g. example.co.uk
+// of www.example.co.uk; refresh it from time to time
+//
+//go:embed public_suffix_list.dat
+var pslData string
+
+// psl is the parsed public suffix list, all the rules are in the
+// normalized form of normalizeHost
+var psl struct {
+	once       sync.Once
+	rules      map[string]bool
+	wildcards  map[string]bool
+	exceptions map[string]bool
+}
+
+// pathDomain is a value of the path_domains setting: a host whose sites
+// are told apart by the first path segments, e.g. 'github.com/*' makes
+// github.com/<user> the domain, 'medium.com/@*' the same for segments
+// starting with '@'; '*.substack.com' means the sites are subdomains
+type pathDomain struct {
+	host     string
+	sub      bool
+	segments []string
+}
+
+// pathDomains is set from the settings by setPathDomains
+var pathDomains []pathDomain
+
+func parsePathDomain(value string) (pathDomain, error) {
+	var pd pathDomain
+
+	parts := strings.Split(value, "/")
+	pd.host = normalizeHost(parts[0])
+	pd.segments = parts[1:]
+	if strings.HasPrefix(pd.host, "*.") {
+		pd.sub = true
+		pd.host = strings.TrimPrefix(pd.host, "*.")
+	}
+
+	switch {
+	case pd.host == "" || strings.Contains(pd.host, "*"):
+		return pd, fmt.Errorf("incorrect host in '%s'", value)
+	case pd.sub && len(pd.segments) > 0:
+		return pd, fmt.Errorf("'%s' has both a subdomain and a path",
+			value)
+	case !pd.sub && len(pd.segments) == 0:
+		return pd, fmt.Errorf("'%s' has neither a subdomain nor a "+
+			"path, expected e.g. '%s/*'", value, value)
+	}
+	for _, s := range pd.segments {
+		if !strings.HasSuffix(s, "*") || strings.Count(s, "*") > 1 {
+			return pd, fmt.Errorf("incorrect path segment '%s' in "+
+				"'%s', expected '*' or 'prefix*'", s, value)
+		}
+	}
+
+	return pd, nil
+}
+
+// sitePath returns the path segments that belong to the domain of an url
+// with the host and the path, e.g. '/torvalds' of github.com/torvalds/linux
+func sitePath(host, path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+
+	for _, pd := range pathDomains {
+		if pd.sub || pd.host != host || len(segments) < len(pd.segments) {
+			continue
+		}
+
+		res := ""
+		for i, s := range pd.segments {
+			prefix := strings.TrimSuffix(s, "*")
+			if segments[i] == "" ||
+				!strings.HasPrefix(segments[i], prefix) {
+
+				res = ""
+				break
+			}
+			res += "/" + segments[i]
+		}
+		if res != "" {
+			return res
+		}
+	}
+
+	return ""
+}
+
+// hnSite returns the value of the HN from?site= link of a domain: the
+// registrable domain, unless path_domains tells that a subdomain or a path
+// is a site of its own, e.g. user.substack.com or github.com/user
+func hnSite(domain string) string {
+	if strings.Contains(domain, "/") {
+		return domain
+	}
+
+	for _, pd := range pathDomains {
+		if !pd.sub || !strings.HasSuffix(domain, "."+pd.host) {
+			continue
+		}
+		labels := strings.Split(strings.TrimSuffix(domain,
+			"."+pd.host), ".")
+		return labels[len(labels)-1] + "." + pd.host
+	}
+
+	if site := registrableDomain(domain); site != "" {
+		return site
+	}
+	return domain
+}
+
+func urlToDomain(rawUrl string) string {
+	rawUrl = strings.TrimSpace(rawUrl)
+	if !strings.Contains(rawUrl, "://") {
+		rawUrl = "http://" + rawUrl
+	}
+	u, err := neturl.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+
+	// Hostname drops userinfo, port and the brackets of IPv6 addresses
+	domain := normalizeHost(u.Hostname())
+
+	prefixes := []string{"git.", "www.", "engineering."}
+	for _, p := range prefixes {
+		rest := strings.TrimPrefix(domain, p)
+		if rest != domain && registrableDomain(rest) != "" {
+			domain = rest
+		}
+	}
+
+	return domain + sitePath(domain, u.Path)
+}
+
+// normalizeHost lowercases the host and converts internationalized labels
+// to punycode, so 'Bücher.example' and 'xn--bcher-kva.example' are the same
+// domain; it's not the full IDNA mapping, but enough for urls in the wild
+func normalizeHost(host string) string {
+	host = strings.NewReplacer("。", ".", "．", ".",
+		"｡", ".").Replace(host)
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			labels[i] = "xn--" + punycode(label)
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// normalizeDomainEntry normalizes a line of blocked.domains: the host part,
+// keeping a leading '*' and the path of github.com/<user> entries
+func normalizeDomainEntry(entry string) string {
+	wildcard := ""
+	if strings.HasPrefix(entry, "*") {
+		wildcard = "*"
+		entry = strings.TrimPrefix(entry, "*")
+	}
+
+	host, path := entry, ""
+	if i := strings.Index(entry, "/"); i >= 0 {
+		host, path = entry[:i], entry[i:]
+	}
+
+	return wildcard + normalizeHost(host) + path
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// publicSuffix returns the part of the domain under which anyone can
+// register a name, e.g. co.uk of example.co.uk or github.io of
+// user.github.io; a TLD not on the list is its own public suffix
+func publicSuffix(domain string) string {
+	psl.once.Do(parsePsl)
+
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		suffix := strings.Join(labels[i:], ".")
+		switch {
+		case psl.exceptions[suffix]:
+			return strings.Join(labels[i+1:], ".")
+		case psl.rules[suffix]:
+			return suffix
+		case i+1 < len(labels) &&
+			psl.wildcards[strings.Join(labels[i+1:], ".")]:
+			return suffix
+		}
+	}
+
+	return labels[len(labels)-1]
+}
+
+// registrableDomain returns the public suffix with the label before it,
+// e.g. example.co.uk of www.example.co.uk; it's empty if the domain is a
+// public suffix itself
+func registrableDomain(domain string) string {
+	if net.ParseIP(domain) != nil {
+		return domain
+	}
+
+	suffix := publicSuffix(domain)
+	if domain == suffix {
+		return ""
+	}
+
+	rest := strings.TrimSuffix(domain, "."+suffix)
+	labels := strings.Split(rest, ".")
+	return labels[len(labels)-1] + "." + suffix
+}
+
+func parsePsl() {
+	psl.rules = make(map[string]bool)
+	psl.wildcards = make(map[string]bool)
+	psl.exceptions = make(map[string]bool)
+
+	for _, line := range strings.Split(pslData, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+
+		rule := fields[0]
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			psl.exceptions[normalizeHost(rule[1:])] = true
+		case strings.HasPrefix(rule, "*."):
+			psl.wildcards[normalizeHost(rule[2:])] = true
+		default:
+			psl.rules[normalizeHost(rule)] = true
+		}
+	}
+}
+
+// punycode encodes a label as in RFC 3492, without the 'xn--' prefix
+func punycode(label string) string {
+	const (
+		base        = 36
+		tMin        = 1
+		tMax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+
+		k := 0
+		for delta > ((base-tMin)*tMax)/2 {
+			delta /= base - tMin
+			k += base
+		}
+		return k + (base-tMin+1)*delta/(delta+skew)
+	}
+	digit := func(d int) byte {
+		if d < 26 {
+			return byte('a' + d)
+		}
+		return byte('0' + d - 26)
+	}
+
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < 0x80 {
+			out = append(out, byte(r))
+		}
+	}
+	b := len(out)
+	if b > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := initialN, 0, initialBias
+	for h := b; h < len(runes); {
+		m := math.MaxInt32
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (h + 1)
+		n = m
+
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+
+			q := delta
+			for k := base; ; k += base {
+				t := k - bias
+				if t < tMin {
+					t = tMin
+				} else if t > tMax {
+					t = tMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, digit(t+(q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out = append(out, digit(q))
+			bias = adapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+
+	return string(out)
+}
+
+// blockDomain checks the domain against blocked.domains; '*.example.com'
+// blocks the subdomains of example.com, '*example.com' also example.com
+// itself, but not notexample.com; an entry without a path, wildcard or not,
+// also blocks the sites of path_domains under it, e.g. twitter.com blocks
+// twitter.com/<user>
+func blockDomain(domains []listEntry, domain string) (bool, reason) {
+	for _, entry := range domains {
+		r := reason{file: "blocked.domains", line: entry.line,
+			pattern: entry.text}
+
+		if entry.text != "" && domainMatches(entry.text, domain) {
+			return true, r
+		}
+	}
+	return false, reason{}
+}
+
+func domainMatches(entry, domain string) bool {
+	if !strings.HasPrefix(entry, "*") {
+		return domain == entry || (!strings.Contains(entry, "/") &&
+			strings.HasPrefix(domain, entry+"/"))
+	}
+
+	host := strings.Split(domain, "/")[0]
+	if strings.HasPrefix(entry, "*.") {
+		return strings.HasSuffix(host, entry[1:])
+	}
+	base := strings.TrimPrefix(entry, "*")
+	return host == base || strings.HasSuffix(host, "."+base)
+}
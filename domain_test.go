@@ -0,0 +1,112 @@
+package main
+
+import "testing"
+
+func TestPunycode(t *testing.T) {
+	// examples from RFC 3492 and the IDNA test vectors
+	tests := []struct {
+		label string
+		want  string
+	}{
+		{"münchen", "mnchen-3ya"},
+		{"bücher", "bcher-kva"},
+		{"bahnhof-zürich", "bahnhof-zrich-4ob"},
+		{"ü", "tda"},
+		{"日本", "wgv71a"},
+		{"правительство", "80aealotwbjpid2k"},
+		{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+	}
+
+	for _, tt := range tests {
+		if got := punycode(tt.label); got != tt.want {
+			t.Errorf("punycode(%q) = %q, want %q", tt.label, got,
+				tt.want)
+		}
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"Bücher.example", "xn--bcher-kva.example"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"例え。テスト", "xn--r8jz45g.xn--zckzah"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeHost(tt.host); got != tt.want {
+			t.Errorf("normalizeHost(%q) = %q, want %q", tt.host, got,
+				tt.want)
+		}
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		domain string
+		suffix string
+		want   string
+	}{
+		{"example.com", "com", "example.com"},
+		{"www.example.co.uk", "co.uk", "example.co.uk"},
+		{"www.co.uk", "co.uk", "www.co.uk"},
+		{"co.uk", "co.uk", ""},
+		{"foo.github.io", "github.io", "foo.github.io"},
+		{"a.b.foo.github.io", "github.io", "foo.github.io"},
+		{"example.unknowntld", "unknowntld", "example.unknowntld"},
+		// wildcard *.ck with the exception !www.ck
+		{"foo.bar.ck", "bar.ck", "foo.bar.ck"},
+		{"www.ck", "ck", "www.ck"},
+		{"xn--bcher-kva.xn--p1ai", "xn--p1ai", "xn--bcher-kva.xn--p1ai"},
+	}
+
+	for _, tt := range tests {
+		if got := publicSuffix(tt.domain); got != tt.suffix {
+			t.Errorf("publicSuffix(%q) = %q, want %q", tt.domain, got,
+				tt.suffix)
+		}
+		if got := registrableDomain(tt.domain); got != tt.want {
+			t.Errorf("registrableDomain(%q) = %q, want %q",
+				tt.domain, got, tt.want)
+		}
+	}
+
+	// IP addresses are their own site
+	if got := registrableDomain("127.0.0.1"); got != "127.0.0.1" {
+		t.Errorf("registrableDomain(%q) = %q, want %q", "127.0.0.1", got,
+			"127.0.0.1")
+	}
+}
+
+func TestDomainMatches(t *testing.T) {
+	tests := []struct {
+		entry  string
+		domain string
+		want   bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "www2.example.com", false},
+		{"example.com", "notexample.com", false},
+		{"*.example.com", "a.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*example.com", "example.com", true},
+		{"*example.com", "a.b.example.com", true},
+		{"*example.com", "notexample.com", false},
+		{"twitter.com", "twitter.com/someone", true},
+		{"*twitter.com", "mobile.twitter.com/someone", true},
+		{"github.com/someone", "github.com/someone", true},
+		{"github.com/someone", "github.com/other", false},
+		{"github.com/someone", "github.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := domainMatches(tt.entry, tt.domain); got != tt.want {
+			t.Errorf("domainMatches(%q, %q) = %v, want %v", tt.entry,
+				tt.domain, got, tt.want)
+		}
+	}
+}
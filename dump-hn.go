@@ -5,17 +5,25 @@
 // characters '\t', '\r' and '\n' are converted to '<_\t_>', '<_\r_>', '<_\n_>'
 // out file: /tmp/hndump.tsv
 // info on chunks not downloaded due to errors: /tmp/hndump_error_chunks.txt
+//
+// usage: dump-hn [-workers 128] [-rate 1000] [-api-url url]
+// the HN API url can be also set with NEWSFILTER_HN_API_URL
+// Ctrl-C stops the dump, chunks already downloaded are kept and the next run
+// continues from there
 
 package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,10 +32,14 @@ import (
 )
 
 // LASTCHUNK must be divisable by CHUNKSIZE
+// WORKERS and RATE (requests per second) are defaults of the flags
 const WORKERS = 128
+const RATE = 1000
+const APIURL = "https://hacker-news.firebaseio.com/v0"
 const CHUNKSIZE = 100
 const LASTCHUNK = 29750000 // 2021-12-31 18:00
 var OUTFILE="/tmp/hndump.tsv"
+var API = APIURL
 
 var MU = &sync.Mutex{}
 
@@ -54,13 +66,31 @@ type url struct {
 	id  int
 }
 
-type result struct {
-	items []hnItem
-	err   error
-}
-
 func main() {
 	var chunks []int
+
+	workers := flag.Int("workers", WORKERS, "max number of chunks "+
+		"downloaded at once")
+	rate := flag.Float64("rate", RATE, "max number of requests per second")
+	apiUrl := flag.String("api-url", APIURL, "base url of the HN API")
+	if env := os.Getenv("NEWSFILTER_HN_API_URL"); env != "" {
+		*apiUrl = env
+	}
+	flag.Parse()
+	API = strings.TrimSuffix(*apiUrl, "/")
+
+	if *workers < 1 {
+		errExit(fmt.Errorf("-workers %d", *workers),
+			"error: at least 1 worker is needed")
+	}
+	if *rate <= 0 {
+		errExit(fmt.Errorf("-rate %g", *rate),
+			"error: rate must be greater than 0")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
 	fmt.Println("reading already processed chunks...")
 	processedChunks := readChunks()
 	for i := 0; i < LASTCHUNK/CHUNKSIZE; i++ {
@@ -71,7 +101,11 @@ func main() {
 
 	fmt.Println("getting the data...")
 	fmt.Print("\033[s") // save the cursor position
-	getItems(chunks)
+	getItems(ctx, chunks, *workers, newLimiter(*rate, *workers))
+	if ctx.Err() != nil {
+		fmt.Println("\ninterrupted.")
+		return
+	}
 	fmt.Println("\ndone.")
 }
 
@@ -115,14 +149,21 @@ func intExists(s []int, el int) bool {
         return s[i] == el
 }
 
-func queryItem(id int) (hnItem, error) {
+func queryItem(ctx context.Context, lim *limiter, id int) (hnItem, error) {
 	var item hnItem
 
-	url := "https://hacker-news.firebaseio.com/v0/item/" +
-		strconv.Itoa(id) + ".json"
+	url := API + "/item/" + strconv.Itoa(id) + ".json"
+
+	err := lim.wait(ctx)
+	if err != nil {
+		return hnItem{}, err
+	}
 
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return hnItem{}, err
+	}
 
 	ua := "Wget/1.20.3 (linux-gnu)"
 	req.Header.Set("User-Agent", ua)
@@ -147,77 +188,53 @@ func queryItem(id int) (hnItem, error) {
 	return item, nil
 }
 
-func queryItems(chunks <-chan int, resCh chan<- result, wg *sync.WaitGroup, w int) {
-	defer wg.Done()
-	for chunk := range chunks {
-		var items []hnItem
-		var chunkErr error
-
-		chunkStart := chunk*CHUNKSIZE + 1
-		chunkEnd := chunk*CHUNKSIZE + CHUNKSIZE
-
-		for id := chunkStart; id <= chunkEnd; id++ {
-			item, err := queryItem(id)
-			if err != nil {
-				chunkErr = err
-				break
-			}
-			items = append(items, item)
-		}
-
-		if chunkErr != nil {
-			MU.Lock()
-			saveErrorChunk(chunk, chunkErr)
-			MU.Unlock()
-			continue
-		}
-
-		MU.Lock()
-		fmt.Print("\033[u\033[K") // restore cursor pos and clear line
-		fmt.Printf("worker %3d saving chunk %10d", w, chunk)
-		MU.Unlock()
-
-		resCh <- result{items, nil}
-	}
-}
-
-func getItems(chunks []int) {
-	var wg sync.WaitGroup
+func queryChunk(ctx context.Context, lim *limiter, chunk int) ([]hnItem, error) {
+	var items []hnItem
 
-	inputCh := make(chan int)
-	resCh := make(chan result)
-
-	w := 0
-	wg.Add(WORKERS)
-	for i := 1; i <= WORKERS; i++ {
-		w++
-		go queryItems(inputCh, resCh, &wg, w)
-	}
+	chunkStart := chunk*CHUNKSIZE + 1
+	chunkEnd := chunk*CHUNKSIZE + CHUNKSIZE
 
-	go func() {
-		for _, chunk := range chunks {
-			inputCh <- chunk
+	for id := chunkStart; id <= chunkEnd; id++ {
+		item, err := queryItem(ctx, lim, id)
+		if err != nil {
+			return nil, err
 		}
-		close(inputCh)
-	}()
+		items = append(items, item)
+	}
 
-	go func() {
-		wg.Wait()
-		close(resCh)
-	}()
+	return items, nil
+}
 
+// getItems downloads the chunks with the shared worker pool; after Ctrl-C
+// chunks in progress are dropped, they're downloaded again on the next run
+func getItems(ctx context.Context, chunks []int, workers int, lim *limiter) {
 	fdOpts := os.O_CREATE | os.O_APPEND | os.O_WRONLY
 	fd, err := os.OpenFile(OUTFILE, fdOpts, 0644)
 	errExit(err, "error: cannot create a file")
 	defer fd.Close()
 
-	for r := range resCh {
+	runPool(ctx, workers, len(chunks), func(i int) {
+		chunk := chunks[i]
+		items, err := queryChunk(ctx, lim, chunk)
+		if ctx.Err() != nil {
+			return
+		}
+
 		MU.Lock()
-		for _, item := range r.items {
+		defer MU.Unlock()
+
+		if err != nil {
+			saveErrorChunk(chunk, err)
+			return
+		}
+
+		fmt.Print("\033[u\033[K") // restore cursor pos and clear line
+		fmt.Printf("saving chunk %10d", chunk)
+
+		for _, item := range items {
 			fmt.Fprintln(fd, logHnLine(item))
 		}
-		MU.Unlock()
-	}
+	})
 }
 
 func saveErrorChunk(chunk int, chunkErr error) {
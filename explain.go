@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// tracer prints the steps of a decision for 'explain'; all the matching
+// functions take a *tracer, which is nil in a normal run and prints nothing
+type tracer struct {
+	w io.Writer
+}
+
+func (t *tracer) printf(format string, a ...interface{}) {
+	if t == nil {
+		return
+	}
+	fmt.Fprintf(t.w, format, a...)
+}
+
+// match prints the result of a lookup in a blocklist
+func (t *tracer) match(list string, found bool, r reason, value string) {
+	if found {
+		t.printf("%s: %s:%d '%s' matches '%s'\n", list, r.file, r.line,
+			r.pattern, value)
+		return
+	}
+	t.printf("%s: nothing matches '%s'\n", list, value)
+}
+
+// explainStory is the 'explain' command: it prints the whole decision trace
+// for an HN story fetched by its ID, or for a story made of a url or a
+// title; flags set the other fields of the story, also of a fetched one
+func explainStory(c cli, args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	source := fs.String("source", "hn", "source whose rules are used")
+	score := fs.Int("score", 0, "points of the story")
+	comments := fs.Int("comments", 0, "number of comments")
+	age := fs.Int("age", 1, "age of the story in hours")
+	domain := fs.String("domain", "", "domain, taken from the url "+
+		"by default")
+	author := fs.String("author", "", "submitter of the story")
+	tags := fs.String("tags", "", "comma-separated tags")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		errExit(errors.New("no story"), "error: expected an HN ID, "+
+			"a url or a title")
+	}
+	arg := strings.Join(fs.Args(), " ")
+
+	if _, ok := sourceByName(*source); !ok {
+		errExit(errors.New(*source), "error: unknown source, known "+
+			"sources: "+strings.Join(sourceNames(), " "))
+	}
+
+	story := newsStory{Source: *source, Hours: *age}
+	_, err := strconv.Atoi(arg)
+	switch {
+	case err == nil:
+		hn, _ := sourceByName("hn")
+		f := newFetcher(context.Background(), c.settings)
+		story, err = hn.Story(f, arg, c.clk.Now())
+		errExit(err, "error: cannot get story "+arg)
+		story.Source = *source
+	case strings.Contains(arg, "://"):
+		story.Url = arg
+		story.Domain = urlToDomain(arg)
+	default:
+		story.Title = arg
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "score":
+			story.Score = *score
+		case "comments":
+			story.Comments = *comments
+		case "age":
+			story.Hours = *age
+		case "domain":
+			story.Domain = normalizeDomainEntry(*domain)
+		case "author":
+			story.By = *author
+		case "tags":
+			story.Tags = strings.Split(*tags, ",")
+		}
+	})
+	if story.Hours > 0 {
+		story.ScoreAvg = story.Score / story.Hours
+	}
+
+	fmt.Printf("title: %s\n"+
+		"url: %s\n"+
+		"domain: %s, author: %s, tags: %s\n"+
+		"%d points, %d comments, %dh old, %d points/h\n\n",
+		story.Title, story.Url, story.Domain, story.By,
+		strings.Join(story.Tags, ","), story.Score, story.Comments,
+		story.Hours, story.ScoreAvg)
+
+	conf := readClassRules(c.progDir)
+	lists := readBlocklists(c.progDir)
+
+	r := storyReason(story, lists, conf, &tracer{os.Stdout})
+	fmt.Printf("\nbucket: %s, by %s\n", r.bucket, reasonString(r))
+}
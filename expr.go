@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expression rules in blocked.keywords start with 'expr:' and combine
+// predicates with 'and', 'or', 'not' and parentheses, e.g.
+//
+//	expr: "crypto" and not domain = "lwn.net"
+//	expr: title ~ "i:w:ai" and (score < 200 or comments < 50)
+//
+// predicates:
+//
+//	"keyword"                 same as title ~ "keyword"
+//	title ~ "keyword"         keyword with optional re:, i:, w: modifiers
+//	domain ~ "keyword"        same for the story domain
+//	author ~ "keyword"        same for the submitter
+//	tag ~ "keyword"           same for any of the story tags (lobste.rs)
+//	domain = "example.com"    exact domain, '*example.com' also subdomains
+//	author = "user"           exact submitter
+//	tag = "culture"           exact tag
+//	score, comments, age      compared to a number with =, !=, <, <=, >, >=;
+//	                          age is in hours
+const exprPrefix = "expr:"
+
+// ruleInput holds the story fields that keyword rules can look at
+type ruleInput struct {
+	title    string
+	domain   string
+	author   string
+	score    int
+	comments int
+	age      int
+	tags     []string
+}
+
+type exprNode interface {
+	eval(in ruleInput) bool
+}
+
+type exprAnd struct{ l, r exprNode }
+type exprOr struct{ l, r exprNode }
+type exprNot struct{ n exprNode }
+
+type exprMatch struct {
+	field string
+	m     matcher
+}
+
+type exprEqual struct {
+	field string
+	value string
+}
+
+// newExprEqual normalizes domains the same way as blocked.domains
+func newExprEqual(field, value string) exprEqual {
+	if field == "domain" {
+		value = normalizeDomainEntry(value)
+	}
+	return exprEqual{field, value}
+}
+
+type exprCompare struct {
+	field string
+	cmp   comparison
+}
+
+func (e exprAnd) eval(in ruleInput) bool { return e.l.eval(in) && e.r.eval(in) }
+func (e exprOr) eval(in ruleInput) bool  { return e.l.eval(in) || e.r.eval(in) }
+func (e exprNot) eval(in ruleInput) bool { return !e.n.eval(in) }
+
+func (e exprMatch) eval(in ruleInput) bool {
+	return e.m.matchesAny(in.texts(e.field))
+}
+
+func (e exprEqual) eval(in ruleInput) bool {
+	for _, v := range in.texts(e.field) {
+		if e.field == "domain" {
+			if domainMatches(e.value, v) {
+				return true
+			}
+		} else if v == e.value {
+			return true
+		}
+	}
+	return false
+}
+
+func (e exprCompare) eval(in ruleInput) bool {
+	return e.cmp.matches(in.number(e.field))
+}
+
+// exprUses tells if any predicate of the expression looks at the field
+func exprUses(n exprNode, field string) bool {
+	switch e := n.(type) {
+	case exprAnd:
+		return exprUses(e.l, field) || exprUses(e.r, field)
+	case exprOr:
+		return exprUses(e.l, field) || exprUses(e.r, field)
+	case exprNot:
+		return exprUses(e.n, field)
+	case exprMatch:
+		return e.field == field
+	case exprEqual:
+		return e.field == field
+	case exprCompare:
+		return e.field == field
+	}
+	return false
+}
+
+// texts returns values of a text field; only tags can have more than one
+func (in ruleInput) texts(field string) []string {
+	switch field {
+	case "domain":
+		return []string{in.domain}
+	case "author":
+		return []string{in.author}
+	case "tag":
+		return in.tags
+	}
+	return []string{in.title}
+}
+
+func (in ruleInput) number(field string) int {
+	switch field {
+	case "score":
+		return in.score
+	case "comments":
+		return in.comments
+	}
+	return in.age
+}
+
+var exprTextFields = []string{"title", "domain", "author", "tag"}
+var exprNumFields = []string{"score", "comments", "age"}
+
+// exprError is a parse error; col is 1-based and counted in characters
+// from the start of the line in the rule file
+type exprError struct {
+	col int
+	msg string
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.col, e.msg)
+}
+
+type exprToken struct {
+	kind string // "str", "num", "ident", "op", "(", ")" or "end"
+	text string
+	col  int
+}
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+// parseExpr parses an expression that starts at column col of its line
+func parseExpr(s string, col int) (exprNode, error) {
+	tokens, err := lexExpr(s, col)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != "end" {
+		return nil, &exprError{t.col, "unexpected '" + t.text + "'"}
+	}
+
+	return n, nil
+}
+
+func lexExpr(s string, col int) ([]exprToken, error) {
+	var tokens []exprToken
+	r := []rune(s)
+
+	for i := 0; i < len(r); {
+		c := r[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+			continue
+
+		case c == '(' || c == ')':
+			tokens = append(tokens,
+				exprToken{string(c), string(c), col + i})
+			i++
+
+		case c == '"':
+			var sb strings.Builder
+			i++
+			for i < len(r) && r[i] != '"' {
+				if r[i] == '\\' && i+1 < len(r) {
+					i++
+				}
+				sb.WriteRune(r[i])
+				i++
+			}
+			if i >= len(r) {
+				return nil, &exprError{col + start,
+					"unterminated string"}
+			}
+			i++
+			tokens = append(tokens,
+				exprToken{"str", sb.String(), col + start})
+
+		case unicode.IsDigit(c) || c == '-':
+			i++
+			for i < len(r) && unicode.IsDigit(r[i]) {
+				i++
+			}
+			tokens = append(tokens,
+				exprToken{"num", string(r[start:i]), col + start})
+
+		case unicode.IsLetter(c):
+			for i < len(r) && (unicode.IsLetter(r[i]) || r[i] == '_') {
+				i++
+			}
+			tokens = append(tokens,
+				exprToken{"ident", string(r[start:i]), col + start})
+
+		case strings.ContainsRune("~=!<>", c):
+			i++
+			if i < len(r) && r[i] == '=' {
+				i++
+			}
+			op := string(r[start:i])
+			if op == "!" || op == "~=" {
+				return nil, &exprError{col + start,
+					"unknown operator '" + op + "'"}
+			}
+			tokens = append(tokens, exprToken{"op", op, col + start})
+
+		default:
+			return nil, &exprError{col + i,
+				"unexpected character '" + string(c) + "'"}
+		}
+	}
+
+	return append(tokens, exprToken{"end", "end of line", col + len(r)}),
+		nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != "end" {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) isWord(word string) bool {
+	t := p.peek()
+	return t.kind == "ident" && strings.ToLower(t.text) == word
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isWord("or") {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = exprOr{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isWord("and") {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = exprAnd{l, r}
+	}
+
+	return l, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isWord("not") {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{n}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+
+	switch t.kind {
+	case "(":
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.next(); c.kind != ")" {
+			return nil, &exprError{c.col,
+				"expected ')', got '" + c.text + "'"}
+		}
+		return n, nil
+
+	case "str":
+		m, err := newMatcher(t.text)
+		if err != nil {
+			return nil, &exprError{t.col, err.Error()}
+		}
+		return exprMatch{"title", m}, nil
+
+	case "ident":
+		return p.parsePredicate(t)
+	}
+
+	return nil, &exprError{t.col, "expected a predicate, got '" +
+		t.text + "'"}
+}
+
+func (p *exprParser) parsePredicate(field exprToken) (exprNode, error) {
+	name := strings.ToLower(field.text)
+	op := p.next()
+	if op.kind != "op" {
+		return nil, &exprError{op.col, "expected an operator after '" +
+			field.text + "', got '" + op.text + "'"}
+	}
+	value := p.next()
+
+	switch {
+	case strIn(exprTextFields, name):
+		if value.kind != "str" {
+			return nil, &exprError{value.col,
+				"expected a quoted string, got '" + value.text + "'"}
+		}
+
+		switch op.text {
+		case "~":
+			m, err := newMatcher(value.text)
+			if err != nil {
+				return nil, &exprError{value.col, err.Error()}
+			}
+			return exprMatch{name, m}, nil
+		case "=":
+			return newExprEqual(name, value.text), nil
+		case "!=":
+			return exprNot{newExprEqual(name, value.text)}, nil
+		}
+
+	case strIn(exprNumFields, name):
+		if value.kind != "num" {
+			return nil, &exprError{value.col,
+				"expected a number, got '" + value.text + "'"}
+		}
+		n, err := strconv.Atoi(value.text)
+		if err != nil {
+			return nil, &exprError{value.col, err.Error()}
+		}
+
+		o := op.text
+		if o == "=" {
+			o = "=="
+		}
+		if strIn(classOps, o) {
+			return exprCompare{name, comparison{name, o, n}}, nil
+		}
+
+	default:
+		return nil, &exprError{field.col, "unknown field '" +
+			field.text + "'"}
+	}
+
+	return nil, &exprError{op.col, "operator '" + op.text +
+		"' can't be used with '" + field.text + "'"}
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestParseExpr(t *testing.T) {
+	in := ruleInput{
+		title:    "Rust in the Linux kernel",
+		domain:   "blog.lwn.net",
+		author:   "alice",
+		score:    150,
+		comments: 40,
+		age:      10,
+		tags:     []string{"linux", "rust"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`"rust"`, false},
+		{`"Rust"`, true},
+		{`"i:w:rust"`, true},
+		{`title ~ "i:w:linux kernel"`, true},
+		{`domain ~ "lwn"`, true},
+		{`domain = "lwn.net"`, false},
+		{`domain = "*lwn.net"`, true},
+		{`domain != "*lwn.net"`, false},
+		{`author = "alice"`, true},
+		{`author ~ "re:^a"`, true},
+		{`tag = "rust"`, true},
+		{`tag = "go"`, false},
+		{`score > 100 and comments >= 40`, true},
+		{`score = 150 and age != 10`, false},
+		{`age < -1`, false},
+		{`not "Rust"`, false},
+		{`not not "Rust"`, true},
+		// 'and' binds tighter than 'or'
+		{`"Go" and "Rust" or score > 100`, true},
+		{`"Go" and ("Rust" or score > 100)`, false},
+		{`"Rust" AND NOT (domain = "*lwn.net" OR score < 50)`, false},
+		{`"Say \"hi\"" or "Linux"`, true},
+	}
+
+	for _, tt := range tests {
+		n, err := parseExpr(tt.expr, 1)
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := n.eval(in); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		col  int
+		want string
+	}{
+		{`"rust`, 1, "column 1: unterminated string"},
+		{`"rust" and`, 1, "column 11: expected a predicate, got " +
+			"'end of line'"},
+		{`"rust" "go"`, 1, "column 8: unexpected 'go'"},
+		{`("rust"`, 7, "column 14: expected ')', got 'end of line'"},
+		{`score ~ 100`, 1, "column 7: operator '~' can't be used " +
+			"with 'score'"},
+		{`score > "100"`, 1, "column 9: expected a number, got '100'"},
+		{`title = 5`, 1, "column 9: expected a quoted string, got '5'"},
+		{`points > 5`, 1, "column 1: unknown field 'points'"},
+		{`title "rust"`, 1, "column 7: expected an operator after " +
+			"'title', got 'rust'"},
+		{`score ! 5`, 1, "column 7: unknown operator '!'"},
+		{`"rust" & "go"`, 1, "column 8: unexpected character '&'"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseExpr(tt.expr, tt.col)
+		if err == nil {
+			t.Errorf("parseExpr(%q): no error, want %q", tt.expr,
+				tt.want)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("parseExpr(%q): %q, want %q", tt.expr, err,
+				tt.want)
+		}
+	}
+}
+
+func TestExprUses(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`tag = "culture"`, true},
+		{`"rust" and not (score > 5 or tag ~ "i:go")`, true},
+		{`"rust" and domain = "lwn.net"`, false},
+		{`title ~ "tag"`, false},
+	}
+
+	for _, tt := range tests {
+		n, err := parseExpr(tt.expr, 1)
+		if err != nil {
+			t.Errorf("parseExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := exprUses(n, "tag"); got != tt.want {
+			t.Errorf("exprUses(%q, tag) = %v, want %v", tt.expr, got,
+				tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fetcher is the http client shared by all sources; requests that time out
+// or get a 5xx or 429 response are retried with exponential backoff and
+// jitter, and once the run has used up its failure budget all further
+// requests fail right away, so a dead server doesn't stall the run; all
+// requests go through a rate limiter and stop when ctx is cancelled
+type fetcher struct {
+	ctx     context.Context
+	client  *http.Client
+	limiter *limiter
+	workers int
+	retries int
+	backoff time.Duration
+	budget  int
+
+	mu       sync.Mutex
+	failures int
+}
+
+var errBudget = errors.New("too many failed requests in this run")
+
+// reddit throttles requests with the default Go User-Agent
+var userAgent = "newsfilter (+https://github.com/h1xxx/newsfilter)"
+
+func newFetcher(ctx context.Context, settings config) *fetcher {
+	timeout, err := time.ParseDuration(settings.value("http_timeout"))
+	if err != nil || timeout <= 0 {
+		errExit(fmt.Errorf("http_timeout: %s",
+			settings.value("http_timeout")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+
+	backoff, err := time.ParseDuration(settings.value("http_backoff"))
+	if err != nil || backoff < 0 {
+		errExit(fmt.Errorf("http_backoff: %s",
+			settings.value("http_backoff")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+
+	retries, err := strconv.Atoi(settings.value("http_retries"))
+	if err != nil || retries < 0 {
+		errExit(fmt.Errorf("http_retries: %s",
+			settings.value("http_retries")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+
+	budget, err := strconv.Atoi(settings.value("http_failures"))
+	if err != nil || budget < 1 {
+		errExit(fmt.Errorf("http_failures: %s",
+			settings.value("http_failures")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+
+	rate, err := strconv.ParseFloat(settings.value("http_rate"), 64)
+	if err != nil || rate <= 0 {
+		errExit(fmt.Errorf("http_rate: %s",
+			settings.value("http_rate")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+
+	workers, err := strconv.Atoi(settings.value("http_workers"))
+	if err != nil || workers < 1 {
+		errExit(fmt.Errorf("http_workers: %s",
+			settings.value("http_workers")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+
+	return &fetcher{
+		ctx:     ctx,
+		client:  &http.Client{Timeout: timeout},
+		limiter: newLimiter(rate, workers),
+		workers: workers,
+		retries: retries,
+		backoff: backoff,
+		budget:  budget,
+	}
+}
+
+// do sends the request, retrying it when needed, and returns the response
+// together with its whole body; the response is returned for every status
+// code, retries only change which one it is
+func (f *fetcher) do(req *http.Request) (*http.Response, []byte, error) {
+	if f.exhausted() {
+		return nil, nil, errBudget
+	}
+
+	req = req.WithContext(f.ctx)
+	req.Header.Set("User-Agent", userAgent)
+	req.Close = true
+
+	var resp *http.Response
+	var body []byte
+	var err error
+
+	for try := 0; try <= f.retries; try++ {
+		if try > 0 {
+			if err != nil {
+				debug("retrying %s: %v\n", req.URL, err)
+			} else {
+				debug("retrying %s: %s\n", req.URL, resp.Status)
+			}
+			t := time.NewTimer(f.delay(try))
+			select {
+			case <-f.ctx.Done():
+				t.Stop()
+			case <-t.C:
+			}
+		}
+
+		if f.limiter.wait(f.ctx) != nil {
+			return nil, nil, f.ctx.Err()
+		}
+
+		resp, body, err = f.send(req)
+		if f.ctx.Err() != nil {
+			return nil, nil, f.ctx.Err()
+		}
+		if err == nil && !retryStatus(resp.StatusCode) {
+			return resp, body, nil
+		}
+	}
+
+	f.mu.Lock()
+	f.failures++
+	f.mu.Unlock()
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, body, nil
+}
+
+func (f *fetcher) send(req *http.Request) (*http.Response, []byte, error) {
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return resp, body, nil
+}
+
+// delay returns the backoff before the given retry: the base backoff doubled
+// on every retry, plus up to the same amount of random jitter so parallel
+// requests don't retry all at once
+func (f *fetcher) delay(try int) time.Duration {
+	d := f.backoff << uint(try-1)
+	if d <= 0 {
+		return 0
+	}
+	return d + time.Duration(rand.Int63n(int64(d)))
+}
+
+func (f *fetcher) exhausted() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failures >= f.budget
+}
+
+// notTried reports if the request failed without reaching the server, so
+// it shouldn't count as a failed try of a story
+func notTried(err error) bool {
+	return err == errBudget || errors.Is(err, context.Canceled)
+}
+
+func retryStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
+}
+
+// getJSON fetches the url and decodes the json response into v
+func (f *fetcher) getJSON(url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := f.do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(url + ": " + resp.Status)
+	}
+
+	return json.Unmarshal(body, v)
+}
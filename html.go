@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"time"
+)
+
+// htmlPage is passed to the 'digest' and 'blocked' templates
+type htmlPage struct {
+	Title    string
+	Sections []htmlSection
+}
+
+type htmlSection struct {
+	Title   string
+	Stories []htmlStory
+}
+
+// htmlStory adds to a story what the templates can't work out themselves:
+// a link to the HN discussion of the same url and the reason for a block
+type htmlStory struct {
+	newsStory
+	HnUrl  string
+	Reason string
+}
+
+// htmlTemplates are the built-in templates; a digest.tmpl file in progDir
+// can redefine any of them, e.g. only 'header' to change the style
+var htmlTemplates = `
+{{- define "header" -}}
+<!DOCTYPE html>
+<html>
+<head>
+	<title>{{.Title}}</title>
+	<meta charset="UTF-8">
+</head>
+
+<style>
+	html, pre {	max-width: 750px;
+			margin: 0 auto;
+			line-height: 1.2;
+			color: #bbb;
+			background-color: #000;
+			-webkit-font-smoothing: none;
+			-webkit-text-stroke: 0.3px;
+	}
+	a {		color: #009900;
+			background-color: transparent;
+			text-decoration: underline;
+	}
+</style>
+
+<body><pre>
+{{end -}}
+
+{{- define "footer" -}}
+</pre></body>
+</html>
+{{end -}}
+
+{{- define "story" -}}
+<a href="{{.Url}}">{{.Title}}</a>
+{{.Hours}}h ago
+{{- if .Unscored}}
+	{{- if .CommentsUrl}}, <a href="{{.CommentsUrl}}">comments</a>{{end}}
+{{- else}}, {{.Score}} points, <a href="{{.CommentsUrl}}">{{.Comments}} comments</a>
+{{- end}} (<a href="{{.DomainUrl}}">{{.Domain}}</a>)
+{{- if ne .Source "hn"}} (
+	{{- if .HnUrl}}<a href="{{.HnUrl}}">hn</a>{{else}}-{{end}})
+{{- end}}
+
+{{end -}}
+
+{{- define "blocked story" -}}
+<a href="{{.Url}}">{{.Title}}</a>
+{{.Score}} points, {{if .CommentsUrl}}<a href="{{.CommentsUrl}}">comments</a>{{else}}-{{end}}, {{.Domain}}
+blocked by: {{.Reason}}
+
+{{end -}}
+
+{{- define "digest" -}}
+{{template "header" .}}
+{{range $i, $s := .Sections -}}
+{{if $i}}
+{{end}}* {{$s.Title}}
+
+{{range $s.Stories}}{{template "story" .}}{{end -}}
+{{end -}}
+{{template "footer" .}}
+{{- end -}}
+
+{{- define "blocked" -}}
+{{template "header" .}}
+{{range $i, $s := .Sections -}}
+{{if $i}}
+{{end}}* blocked {{$s.Title}} stories
+
+{{range $s.Stories}}{{template "blocked story" .}}{{end -}}
+{{end -}}
+{{template "footer" .}}
+{{- end -}}
+`
+
+func readTemplates(progDir string) *template.Template {
+	t, err := template.New("html").Parse(htmlTemplates)
+	errExit(err, "error: cannot parse built-in templates")
+
+	b, err := os.ReadFile(progDir + "digest.tmpl")
+	if os.IsNotExist(err) {
+		return t
+	}
+	errExit(err, "error: cannot read file")
+
+	_, err = t.New("digest.tmpl").Parse(string(b))
+	errExit(err, "error: cannot parse digest.tmpl")
+
+	return t
+}
+
+func writeHtml(progDir, file, name string, page htmlPage) {
+	t := readTemplates(progDir)
+
+	fdOpts := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	fd, err := os.OpenFile(progDir+file, fdOpts, 0644)
+	errExit(err, "error: cannot create file")
+	defer fd.Close()
+
+	err = t.ExecuteTemplate(fd, name, page)
+	errExit(err, "error: cannot write "+file)
+}
+
+func prepareHtml(all []*results, hnUrls []url, progDir string,
+	now time.Time) {
+
+	dt := fmt.Sprintf("%d-%.2d-%.2d_%.2d%.2d",
+		now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute())
+	file := "news_" + dt + ".html"
+
+	page := htmlPage{Title: "news"}
+	for _, res := range all {
+		if len(res.stories["main"]) == 0 {
+			continue
+		}
+
+		section := htmlSection{Title: res.source.Title()}
+		for _, story := range res.stories["main"] {
+			section.Stories = append(section.Stories,
+				htmlStory{newsStory: story,
+					HnUrl: hnDiscussion(story, hnUrls)})
+		}
+		page.Sections = append(page.Sections, section)
+	}
+
+	writeHtml(progDir, file, "digest", page)
+}
+
+// hnDiscussion returns a link to the HN discussion of the story url for
+// stories from other sources than HN, if there was one
+func hnDiscussion(story newsStory, hnUrls []url) string {
+	if story.Source == "hn" {
+		return ""
+	}
+
+	hnExists, idx := urlExists(hnUrls, story.Url)
+	if !hnExists {
+		return ""
+	}
+
+	return hnUrl + "/item?id=" + hnUrls[idx].id
+}
+
+// reportBlocked writes an html page with blocked stories of all enabled
+// sources sorted by score, each with the rule that blocked it
+func reportBlocked(progDir string, settings config, now time.Time) {
+	dt := fmt.Sprintf("%d-%.2d-%.2d_%.2d%.2d",
+		now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute())
+	file := "blocked_" + dt + ".html"
+
+	page := htmlPage{Title: "blocked"}
+	for _, source := range settings.sources() {
+		stories := readLog(progDir, source.Name(),
+			source.Name()+"_blocked.tsv")
+		if len(stories) == 0 {
+			continue
+		}
+
+		sort.SliceStable(stories, func(i, j int) bool {
+			return stories[i].Score > stories[j].Score
+		})
+
+		section := htmlSection{Title: source.Title()}
+		for _, story := range stories {
+			section.Stories = append(section.Stories,
+				htmlStory{newsStory: story,
+					Reason: reasonString(story.Reason)})
+		}
+		page.Sections = append(page.Sections, section)
+	}
+
+	writeHtml(progDir, file, "blocked", page)
+
+	fmt.Println(progDir + file)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// keywordRule is a parsed line of blocked.keywords: a title matching the
+// keyword is blocked unless it also matches any of the overrides; for lines
+// starting with 'tag:' the keyword is matched against story tags instead of
+// the title; lines starting with 'expr:' are parsed into expr, see expr.go
+type keywordRule struct {
+	line      int
+	keyword   matcher
+	overrides []matcher
+	tag       bool
+	expr      exprNode
+	text      string
+}
+
+const tagPrefix = "tag:"
+
+// matcher is a keyword with optional modifiers in front of it:
+//
+//	re:  the rest of the keyword is a regular expression
+//	i:   match case-insensitively
+//	w:   match whole words only
+//
+// modifiers can be combined in any order, e.g. 'i:w:go'; keywords without
+// modifiers are matched as plain substrings
+type matcher struct {
+	raw   string
+	plain string
+	re    *regexp.Regexp
+}
+
+// readBlockedKeywords returns title rules and tag: rules separately
+func readBlockedKeywords(file string) ([]keywordRule, []keywordRule) {
+	rules, errs := parseKeywords(readList(file))
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Println(filepath.Base(file) + ":" + err.Error())
+		}
+		errExit(errors.New(file),
+			"error: incorrect rules in "+filepath.Base(file))
+	}
+
+	var keywords, tags []keywordRule
+	for _, rule := range rules {
+		if rule.tag {
+			tags = append(tags, rule)
+		} else {
+			keywords = append(keywords, rule)
+		}
+	}
+
+	return keywords, tags
+}
+
+// parseKeywords parses all the entries and returns every error found,
+// each prefixed with the line and column of the offending rule
+func parseKeywords(entries []listEntry) ([]keywordRule, []error) {
+	var rules []keywordRule
+	var errs []error
+
+	for _, entry := range entries {
+		rule, skip, err := parseKeywordLine(entry)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !skip {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, errs
+}
+
+func parseKeywordLine(entry listEntry) (keywordRule, bool, error) {
+	rule := keywordRule{line: entry.line, text: entry.text}
+	words := strings.Split(entry.text, "\t")
+
+	if words[0] == "" || strings.HasPrefix(words[0], "#") {
+		return rule, true, nil
+	}
+
+	if strings.HasPrefix(entry.text, exprPrefix) {
+		var err error
+		text := strings.TrimPrefix(entry.text, exprPrefix)
+		col := utf8.RuneCountInString(exprPrefix) + 1
+		rule.expr, err = parseExpr(text, col)
+		if err != nil {
+			return rule, false, fmt.Errorf("%d: %v", entry.line, err)
+		}
+		rule.text = strings.TrimSpace(text)
+		// rules with tags go with the 'tag:' keywords, so they run
+		// for the sources with the tags filter, e.g. lobste.rs
+		rule.tag = exprUses(rule.expr, "tag")
+		return rule, false, nil
+	}
+
+	keyword := words[0]
+	if strings.HasPrefix(keyword, tagPrefix) {
+		rule.tag = true
+		keyword = strings.TrimPrefix(keyword, tagPrefix)
+	}
+
+	var err error
+	rule.keyword, err = newMatcher(keyword)
+	if err != nil {
+		return rule, false, fmt.Errorf("%d: column 1: %v",
+			entry.line, err)
+	}
+	rule.keyword.raw = words[0]
+
+	col := utf8.RuneCountInString(words[0]) + 2
+	for _, word := range words[1:] {
+		if !strings.HasPrefix(word, "!") || word == "!" {
+			return rule, false, fmt.Errorf("%d: column %d: "+
+				"incorrect override '%s', expected '!word'",
+				entry.line, col, word)
+		}
+
+		m, err := newMatcher(strings.TrimPrefix(word, "!"))
+		if err != nil {
+			return rule, false, fmt.Errorf("%d: column %d: %v",
+				entry.line, col, err)
+		}
+		m.raw = word
+		rule.overrides = append(rule.overrides, m)
+
+		col += utf8.RuneCountInString(word) + 1
+	}
+
+	return rule, false, nil
+}
+
+// modifiers splits the modifiers off a keyword
+func modifiers(word string) (string, bool, bool, bool) {
+	var isRe, caseless, whole bool
+
+	for {
+		switch {
+		case strings.HasPrefix(word, "re:"):
+			isRe = true
+			word = strings.TrimPrefix(word, "re:")
+			continue
+		case strings.HasPrefix(word, "i:"):
+			caseless = true
+			word = strings.TrimPrefix(word, "i:")
+			continue
+		case strings.HasPrefix(word, "w:"):
+			whole = true
+			word = strings.TrimPrefix(word, "w:")
+			continue
+		}
+		break
+	}
+
+	return word, isRe, caseless, whole
+}
+
+func newMatcher(word string) (matcher, error) {
+	m := matcher{raw: word}
+	word, isRe, caseless, whole := modifiers(word)
+
+	if word == "" {
+		return m, fmt.Errorf("empty keyword in '%s'", m.raw)
+	}
+
+	if !isRe && !caseless && !whole {
+		m.plain = word
+		return m, nil
+	}
+
+	expr := word
+	if !isRe {
+		expr = regexp.QuoteMeta(word)
+	}
+	if whole {
+		expr = `(^|[^\pL\pN_])(?:` + expr + `)($|[^\pL\pN_])`
+	}
+	if caseless {
+		expr = `(?i)` + expr
+	}
+
+	var err error
+	m.re, err = regexp.Compile(expr)
+	if err != nil {
+		return m, fmt.Errorf("incorrect keyword '%s': %v", m.raw, err)
+	}
+
+	return m, nil
+}
+
+func (m matcher) matches(s string) bool {
+	if m.re != nil {
+		return m.re.MatchString(s)
+	}
+	return strings.Contains(s, m.plain)
+}
+
+func (m matcher) matchesAny(s []string) bool {
+	for _, el := range s {
+		if m.matches(el) {
+			return true
+		}
+	}
+	return false
+}
+
+// keywordFound returns the first rule matching the story; rules that
+// match, but are cancelled by an override, are printed to t
+func keywordFound(keywords []keywordRule, in ruleInput,
+	t *tracer) (bool, reason) {
+
+	for _, rule := range keywords {
+		if rule.expr != nil {
+			if rule.expr.eval(in) {
+				r := reason{
+					file:    "blocked.keywords",
+					line:    rule.line,
+					pattern: exprPrefix + " " + rule.text,
+				}
+				t.printf("  blocked.keywords:%d '%s' is true\n",
+					rule.line, r.pattern)
+				return true, r
+			}
+			continue
+		}
+
+		if rule.tag && !rule.keyword.matchesAny(in.tags) {
+			continue
+		}
+		if !rule.tag && !rule.keyword.matches(in.title) {
+			continue
+		}
+		t.printf("  blocked.keywords:%d '%s' matches\n", rule.line,
+			rule.keyword.raw)
+
+		if blockOverride(rule, in.title, t) {
+			continue
+		}
+
+		r := reason{
+			file:    "blocked.keywords",
+			line:    rule.line,
+			pattern: rule.keyword.raw,
+		}
+		for _, o := range rule.overrides {
+			r.overrides = append(r.overrides, o.raw)
+		}
+		return true, r
+	}
+	t.printf("  no rule blocks the story\n")
+	return false, reason{}
+}
+
+func blockOverride(rule keywordRule, title string, t *tracer) bool {
+	for _, o := range rule.overrides {
+		if o.matches(title) {
+			t.printf("    override '%s' matches, rule cancelled\n",
+				o.raw)
+			return true
+		}
+		t.printf("    override '%s' doesn't match\n", o.raw)
+	}
+	return false
+}
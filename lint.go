@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// lintIssue is a problem found in a line of a blocklist
+type lintIssue struct {
+	file string
+	line int
+	msg  string
+}
+
+// lintRules is 'rules lint': it checks blocked.keywords and blocked.domains
+// for lines that are malformed or never change the verdict of a story,
+// prints every issue and fails if there are any
+func lintRules(c cli, args []string) {
+	fs := flag.NewFlagSet("rules lint", flag.ExitOnError)
+	domains := fs.String("domains", c.progDir+"blocked.domains",
+		"blocked.domains to check")
+	keywords := fs.String("keywords", c.progDir+"blocked.keywords",
+		"blocked.keywords to check")
+	fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		errExit(errors.New(fs.Arg(0)), "error: unexpected arguments")
+	}
+
+	issues := lintKeywords(*keywords)
+	issues = append(issues, lintDomains(*domains)...)
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].file != issues[j].file {
+			return issues[i].file < issues[j].file
+		}
+		return issues[i].line < issues[j].line
+	})
+	for _, is := range issues {
+		fmt.Printf("%s:%d: %s\n", is.file, is.line, is.msg)
+	}
+
+	fmt.Printf("%d issues\n", len(issues))
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+func lintKeywords(file string) []lintIssue {
+	var issues []lintIssue
+	name := filepath.Base(file)
+	add := func(line int, format string, a ...interface{}) {
+		issues = append(issues, lintIssue{name, line,
+			fmt.Sprintf(format, a...)})
+	}
+
+	var rules []keywordRule
+	for _, entry := range readList(file) {
+		if trailingSpace(entry.text) {
+			add(entry.line, "trailing whitespace, 'w:' matches "+
+				"whole words")
+		}
+
+		rule, skip, err := parseKeywordLine(entry)
+		if err != nil {
+			add(entry.line, "%s", strings.TrimPrefix(err.Error(),
+				fmt.Sprintf("%d: ", entry.line)))
+			continue
+		}
+		if !skip && rule.expr == nil {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].line < rules[j].line
+	})
+
+	for i, b := range rules {
+		bWord := strings.TrimPrefix(b.keyword.raw, tagPrefix)
+
+		for j, a := range rules {
+			if i == j || a.tag != b.tag {
+				continue
+			}
+			aWord := strings.TrimPrefix(a.keyword.raw, tagPrefix)
+
+			switch {
+			case a.text == b.text:
+				if j < i {
+					add(b.line, "duplicate of line %d", a.line)
+				}
+			case aWord == bWord:
+				if j < i {
+					add(b.line, "keyword '%s' is also on line %d, "+
+						"merge the overrides", bWord, a.line)
+				}
+			case strings.ToLower(aWord) == strings.ToLower(bWord):
+				// reported once for the whole group below
+			case len(a.overrides) == 0 && covers(aWord, bWord):
+				add(b.line, "'%s' is shadowed by '%s' on line %d",
+					bWord, aWord, a.line)
+			}
+		}
+
+		for k, o := range b.overrides {
+			oWord := strings.TrimPrefix(o.raw, "!")
+			if !b.tag && covers(oWord, bWord) {
+				add(b.line, "override '%s' matches every title "+
+					"'%s' matches, the rule never blocks", o.raw,
+					bWord)
+			}
+
+			for l, p := range b.overrides {
+				pWord := strings.TrimPrefix(p.raw, "!")
+				switch {
+				case k == l || !covers(pWord, oWord):
+				case p.raw == o.raw:
+					if l < k {
+						add(b.line, "duplicate override '%s'",
+							o.raw)
+					}
+				case l < k:
+					add(b.line, "override '%s' never fires, "+
+						"'%s' matches first", o.raw, p.raw)
+				default:
+					add(b.line, "override '%s' is redundant "+
+						"with '%s'", o.raw, p.raw)
+				}
+			}
+		}
+	}
+
+	// case variants are reported against the first line of the group,
+	// e.g. 'Crypto', 'crypto' and 'CRYPTO' make one issue
+	variants := make(map[string][]keywordRule)
+	var groups []string
+	for _, r := range rules {
+		word := strings.TrimPrefix(r.keyword.raw, tagPrefix)
+		key := fmt.Sprint(r.tag, strings.ToLower(word))
+		if _, ok := variants[key]; !ok {
+			groups = append(groups, key)
+		}
+		variants[key] = append(variants[key], r)
+	}
+	for _, key := range groups {
+		group := variants[key]
+		first := strings.TrimPrefix(group[0].keyword.raw, tagPrefix)
+		var lines []string
+		for _, r := range group[1:] {
+			word := strings.TrimPrefix(r.keyword.raw, tagPrefix)
+			if word != first {
+				lines = append(lines, strconv.Itoa(r.line))
+			}
+		}
+		if len(lines) > 0 {
+			add(group[0].line, "'%s' has case variants on lines %s, "+
+				"use 'i:%s'", first, strings.Join(lines, ", "),
+				strings.ToLower(first))
+		}
+	}
+	return issues
+}
+
+// covers tells if every text matching the keyword b also matches the
+// keyword a; it's false whenever that can't be decided, e.g. for re:
+func covers(a, b string) bool {
+	aWord, aRe, aCase, aWhole := modifiers(a)
+	bWord, bRe, bCase, bWhole := modifiers(b)
+
+	if aRe || bRe || (bCase && !aCase) {
+		return false
+	}
+	if aCase {
+		aWord = strings.ToLower(aWord)
+		bWord = strings.ToLower(bWord)
+	}
+	if aWhole {
+		return bWhole && aWord == bWord
+	}
+	return strings.Contains(bWord, aWord)
+}
+
+func lintDomains(file string) []lintIssue {
+	var issues []lintIssue
+	name := filepath.Base(file)
+	add := func(line int, format string, a ...interface{}) {
+		issues = append(issues, lintIssue{name, line,
+			fmt.Sprintf(format, a...)})
+	}
+
+	var entries []listEntry
+	for _, entry := range readList(file) {
+		d := entry.text
+		if trailingSpace(d) {
+			add(entry.line, "trailing whitespace")
+			d = strings.TrimRightFunc(d, unicode.IsSpace)
+		}
+
+		switch {
+		case d == "":
+			continue
+		case strings.Contains(d, "://"):
+			add(entry.line, "'%s' is a url, expected a domain", d)
+		case strings.IndexFunc(d, unicode.IsSpace) >= 0:
+			add(entry.line, "whitespace in '%s'", d)
+		case strings.LastIndex(d, "*") > 0:
+			add(entry.line, "'*' is allowed only at the start of "+
+				"'%s'", d)
+		case strings.HasSuffix(d, "/") || strings.HasSuffix(d, "."):
+			add(entry.line, "'%s' never matches, remove the "+
+				"trailing '%s'", d, d[len(d)-1:])
+		case normalizeDomainEntry(d) != d:
+			add(entry.line, "'%s' is matched as '%s'", d,
+				normalizeDomainEntry(d))
+		}
+		entries = append(entries, listEntry{entry.line, d})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].line < entries[j].line
+	})
+
+	for i, d := range entries {
+		for j, w := range entries {
+			switch {
+			case i == j:
+			case w.text == d.text:
+				if j < i {
+					add(d.line, "duplicate of line %d", w.line)
+				}
+			case w.text == "*."+d.text:
+				add(d.line, "'%s' and '%s' on line %d block the "+
+					"same site, one '*%s' entry would do", d.text,
+					w.text, w.line, d.text)
+			case strings.HasPrefix(w.text, "*"):
+				found, _ := blockDomain([]listEntry{w},
+					strings.TrimPrefix(d.text, "*"))
+				if found {
+					add(d.line, "redundant, '%s' on line %d "+
+						"matches it", w.text, w.line)
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+func trailingSpace(s string) bool {
+	return strings.TrimRightFunc(s, unicode.IsSpace) != s
+}
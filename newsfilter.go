@@ -2,13 +2,12 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,47 +15,48 @@ import (
 	"time"
 )
 
-type hnStory struct {
-	ID       int    `json:"id"`
-	By       string `json:"by"`
-	Score    int    `json:"score"`
-	Comments int    `json:"descendants"`
-	TimeI    int64  `json:"time"`
-	Title    string `json:"title"`
-	Url      string `json:"url"`
-	Type     string `json:"type"`
-	Domain   string
-	ScoreAvg int
-	Time     time.Time
-	Hours    int
+// results holds everything a single source produced in this run
+type results struct {
+	source       Source
+	candidates   []string
+	processedIDs []string
+	stories      map[string][]newsStory
+
+	// err is set when the candidates couldn't be fetched and the source
+	// was skipped; failed stories aren't marked as processed, they go to
+	// the pending queue to be tried again on the next run
+	err     error
+	failed  map[string]error
+	pending map[string]int
+}
+
+// reason records which rule put a story in its bucket; file and line are
+// empty for the built-in rules that don't come from any file
+type reason struct {
+	bucket    string
+	file      string
+	line      int
+	pattern   string
+	overrides []string
 }
 
-type lrsStory struct {
-	ID       string `json:"short_id"`
-	TimeS    string `json:"created_at"`
-	Title    string `json:"title"`
-	Url      string `json:"url"`
-	Score    int    `json:"score"`
-	Comments int    `json:"comment_count"`
-	LrsUrl   string `json:"comments_url"`
-	Domain   string
-	Time     time.Time
-	Hours    int
+// blocklists holds all the parsed blocklist files from progDir
+type blocklists struct {
+	domains  []listEntry
+	keywords []keywordRule
+	tags     []keywordRule
+	users    []listEntry
 }
 
-type hnResults struct {
-	mainStories     []hnStory
-	blockedStories  []hnStory
-	lowStories      []hnStory
-	permaLowStories []hnStory
-	storyIDs        []int
-	processedIDs    []int
-	urls            []url
+// listEntry is a single line of a blocklist file with its line number
+type listEntry struct {
+	line int
+	text string
 }
 
 type url struct {
 	url string
-	id  int
+	id  string
 }
 
 type article struct {
@@ -69,162 +69,257 @@ var MU = &sync.Mutex{}
 var PL = false
 
 func main() {
-	var hn hnResults
+	c, args := parseFlags()
+	runCommand(c, args)
+}
+
+// runNews is the 'run' command, the whole pipeline: fetch new stories of
+// all the sources, put them in buckets, log them and write the outputs
+func runNews(c cli, args []string) {
+	var all []*results
+	var err error
+
+	if len(args) > 0 {
+		errExit(errors.New(strings.Join(args, " ")),
+			"error: unexpected arguments")
+	}
+	progDir, settings := c.progDir, c.settings
+
+	// on Ctrl-C stop fetching and log the stories fetched so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// settings are checked before fetching, so a typo doesn't throw away
+	// a whole run
+	f := newFetcher(ctx, settings)
+	maxTries, err := strconv.Atoi(settings.value("pending_tries"))
+	if err != nil || maxTries < 1 {
+		errExit(fmt.Errorf("pending_tries: %s",
+			settings.value("pending_tries")),
+			"error: incorrect setting in newsfilter.conf")
+	}
+	outputs := settings.outputs()
+	if strIn(outputs, "atom") || strIn(outputs, "rss") {
+		settings.feedEntries()
+	}
+	now := c.clk.Now()
+
+	conf := readClassRules(progDir)
+	lists := readBlocklists(progDir)
+
+	for _, source := range settings.sources() {
+		if ctx.Err() != nil {
+			break
+		}
+
+		res := &results{source: source,
+			stories: make(map[string][]newsStory),
+			failed:  make(map[string]error)}
+		all = append(all, res)
 
-	homeDir, err := os.UserHomeDir()
-	errExit(err, "error: cannot get home dir")
-	progDir := homeDir + "/.local/share/newsfilter/"
+		if s, ok := source.(sourceSetup); ok {
+			err = s.Setup(progDir, settings)
+			errExit(err, "error: cannot set up "+source.Title())
+		}
 
-	client := &http.Client{}
-	now := time.Now()
+		info("getting %s stories...\n", source.Title())
+		res.candidates, err = source.Candidates(f)
+		if err != nil {
+			res.err = err
+			fmt.Printf("error: cannot get %s stories, skipping: %v\n",
+				source.Title(), err)
+			continue
+		}
 
-	fmt.Println("getting HN stories...")
-	getHnStoryIDs(client, &hn)
+		info("getting already processed %s IDs...\n",
+			source.Title())
+		res.processedIDs = readProcessedIDs(progDir, source.Name())
+		res.pending = readPending(progDir, source.Name())
+		addPending(res)
 
-	fmt.Println("getting already processed HN IDs...")
-	readHnProcessedIDs(&hn, progDir)
+		info("filtering %s stories...\n", source.Title())
+		filterSource(res, f, now, lists, conf)
+	}
 
-	fmt.Println("filtering HN stories...")
-	filterHn(&hn, client, now, progDir)
+	// stop cancels ctx, so it has to be checked first
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		info("interrupted, saving stories fetched so far...\n")
+	}
+	stop()
 
-	fmt.Println("getting lobste.rs stories...")
-	lrsStories := getLrsStories(client, now)
+	info("logging all stories...\n")
+	for _, res := range all {
+		logStories(res, progDir)
+		if res.err == nil {
+			updatePending(res, progDir, maxTries)
+		}
 
-	fmt.Println("getting already processed lobste.rs IDs...")
-	lrsProcessedIDs := readLrsProcessedIDs(progDir)
+		// the state of an interrupted run would skip the stories
+		// that weren't fetched yet
+		if s, ok := res.source.(sourceCommitter); ok && !interrupted {
+			err = s.Commit()
+			errExit(err, "error: cannot save "+res.source.Title())
+		}
+	}
 
-	fmt.Println("filtering lobste.rs stories...")
-	lrsStories = filterLrs(lrsStories, &lrsProcessedIDs)
+	info("reading history of HN URLs...\n")
+	hnUrls := readHnUrls(progDir)
 
-	fmt.Println("logging all stories...")
-	logHnStories(&hn, progDir)
-	logLrsStories(lrsStories, progDir)
+	if strIn(outputs, "html") {
+		info("preparing final html file...\n")
+		prepareHtml(all, hnUrls, progDir, now)
+	}
 
-	fmt.Println("reading history of HN URLs...")
-	readHnUrls(&hn, progDir)
+	info("updating feeds...\n")
+	prepareFeeds(all, settings, progDir, now)
 
-	fmt.Println("preparing final html file...")
-	prepareHtml(&hn, &lrsStories, progDir, now)
+	for _, res := range all {
+		info("\n%s stats\n", res.source.Title())
+		if res.err != nil {
+			info("not fetched: %v\n", res.err)
+			continue
+		}
+		info("fetched stories: %d\n"+
+			"processed stories: %d\n"+
+			"blocked stories: %d\n"+
+			"low score stories: %d\n"+
+			"permanently low score stories: %d\n"+
+			"main stories: %d\n"+
+			"failed stories: %d\n"+
+			"pending stories: %d\n",
+			len(res.candidates),
+			len(res.processedIDs),
+			len(res.stories["blocked"]),
+			len(res.stories["low"]),
+			len(res.stories["permalow"]),
+			len(res.stories["main"]),
+			len(res.failed),
+			len(res.pending))
+		printFailed(res)
+	}
 
-	fmt.Println("\nHN stats")
-	fmt.Printf("fetched stories: %d\n"+
-		"processed stories: %d\n"+
-		"blocked stories: %d\n"+
-		"low score stories: %d\n"+
-		"permanently low score stories: %d\n"+
-		"main stories: %d\n",
-		len(hn.storyIDs),
-		len(hn.processedIDs),
-		len(hn.blockedStories),
-		len(hn.lowStories),
-		len(hn.permaLowStories),
-		len(hn.mainStories))
+	info("\n")
+	if strIn(outputs, "html") {
+		dt := fmt.Sprintf("%d-%.2d-%.2d_%.2d%.2d", now.Year(),
+			now.Month(), now.Day(), now.Hour(), now.Minute())
+		outFile := "news_" + dt + ".html"
+		fmt.Println(progDir + outFile)
+	}
+	if strIn(outputs, "atom") {
+		fmt.Println(progDir + "newsfilter.atom")
+	}
+	if strIn(outputs, "rss") {
+		fmt.Println(progDir + "newsfilter.rss")
+	}
 
-	fmt.Println("\nlobste.rs stats")
-	fmt.Printf("processed stories: %d\n"+
-		"main stories: %d\n",
-		len(lrsProcessedIDs),
-		len(lrsStories))
+	clearTmp(progDir, all)
+}
 
-	dt := fmt.Sprintf("%d-%.2d-%.2d_%.2d%.2d",
-		now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute())
-	outFile := "news_" + dt + ".html"
-	fmt.Println(progDir + outFile)
+// printFailed lists stories that failed in this run sorted by ID
+func printFailed(res *results) {
+	var ids []string
+	for id := range res.failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
 
-	clearTmp(progDir)
+	for _, id := range ids {
+		info("  %s: %v\n", id, res.failed[id])
+	}
 }
 
-func readBlockedDomains(progDir string) []string {
-	var blockedDomains []string
+func readBlocklists(progDir string) blocklists {
+	return readBlocklistFiles(progDir+"blocked.domains",
+		progDir+"blocked.keywords", progDir+"blocked.users")
+}
 
-	f, err := os.Open(progDir + "blocked.domains")
-	errExit(err, "error: cannot read file")
-	defer f.Close()
+// readBlocklistFiles reads blocklists from other files than the ones in
+// progDir, e.g. proposed rules for 'rules backtest'
+func readBlocklistFiles(domains, keywords, users string) blocklists {
+	titles, tags := readBlockedKeywords(keywords)
 
-	input := bufio.NewScanner(f)
-	for input.Scan() {
-		blockedDomains = append(blockedDomains, input.Text())
+	entries := readList(domains)
+	for i := range entries {
+		entries[i].text = normalizeDomainEntry(entries[i].text)
 	}
-	sort.Strings(blockedDomains)
 
-	return blockedDomains
+	return blocklists{
+		domains:  entries,
+		keywords: titles,
+		tags:     tags,
+		users:    readBlockedUsers(users),
+	}
 }
 
-func readBlockedKeywords(progDir string) []string {
-	var blockedKeywords []string
+func readList(file string) []listEntry {
+	var entries []listEntry
 
-	f, err := os.Open(progDir + "blocked.keywords")
+	f, err := os.Open(file)
 	errExit(err, "error: cannot read file")
 	defer f.Close()
 
 	input := bufio.NewScanner(f)
-	for input.Scan() {
-		blockedKeywords = append(blockedKeywords, input.Text())
+	for i := 1; input.Scan(); i++ {
+		entries = append(entries, listEntry{line: i, text: input.Text()})
 	}
-	sort.Strings(blockedKeywords)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].text < entries[j].text
+	})
 
-	return blockedKeywords
+	return entries
 }
 
-func readHnProcessedIDs(hn *hnResults, progDir string) {
-	fd, err := os.Open(progDir + "hn_processed_ids")
-	defer fd.Close()
+func readProcessedIDs(progDir, source string) []string {
+	var processedIDs []string
+
+	fd, err := os.Open(progDir + source + "_processed_ids")
 	if err != nil {
-		return
+		return processedIDs
 	}
+	defer fd.Close()
 
 	input := bufio.NewScanner(fd)
 	for input.Scan() {
-		id, err := strconv.Atoi(input.Text())
-		errExit(err, "error: cannot read processed ID")
-		hn.processedIDs = append(hn.processedIDs, id)
+		processedIDs = append(processedIDs, input.Text())
 	}
-	sort.Ints(hn.processedIDs)
+	sort.Strings(processedIDs)
+
+	return processedIDs
 }
 
-func readHnUrls(hn *hnResults, progDir string) {
+// readHnUrls reads URLs of all logged HN stories, so stories from other
+// sources can link to their HN discussion; the urls are kept in the form of
+// canonicalUrl
+func readHnUrls(progDir string) []url {
+	var urls []url
+
 	files := []string{"hn_main.tsv", "hn_permalow.tsv",
 		"hn_blocked.tsv", "hn_low.tsv.tmp"}
 
 	for _, f := range files {
 		fd, err := os.Open(progDir + f)
-		defer fd.Close()
 		if err != nil {
-			return
+			continue
 		}
 
 		input := bufio.NewScanner(fd)
 		for input.Scan() {
 			s := strings.Split(input.Text(), "\t")
-			u := s[8]
-			i, err := strconv.Atoi(s[2])
-			errExit(err, "error: cannot read story ID: "+s[2])
-
-			hn.urls = append(hn.urls, url{url: u, id: i})
+			if len(s) < 9 {
+				continue
+			}
+			urls = append(urls, url{url: canonicalUrl(s[8]),
+				id: s[2]})
 		}
+		fd.Close()
 	}
 
-	sort.Slice(hn.urls, func(i, j int) bool {
-		return hn.urls[i].url <= hn.urls[j].url
+	sort.Slice(urls, func(i, j int) bool {
+		return urls[i].url <= urls[j].url
 	})
-}
-
-func readLrsProcessedIDs(progDir string) []string {
-	var processedIDs []string
 
-	fd, err := os.Open(progDir + "lrs_processed_ids")
-	defer fd.Close()
-	if err != nil {
-		return processedIDs
-	}
-
-	input := bufio.NewScanner(fd)
-	for input.Scan() {
-		processedIDs = append(processedIDs, input.Text())
-	}
-	sort.Strings(processedIDs)
-
-	return processedIDs
+	return urls
 }
 
 func strExists(s []string, el string) bool {
@@ -235,378 +330,183 @@ func strExists(s []string, el string) bool {
 	return s[i] == el
 }
 
-func urlExists(hn *hnResults, url string) (bool, int) {
-	idx := sort.Search(len(hn.urls), func(i int) bool {
-		return string(hn.urls[i].url) >= url
+// urlExists tells if any of the urls read by readHnUrls is the same page as
+// the url
+func urlExists(urls []url, url string) (bool, int) {
+	url = canonicalUrl(url)
+	idx := sort.Search(len(urls), func(i int) bool {
+		return urls[i].url >= url
 	})
 
-	if idx >= len(hn.urls) {
-		return false, 0
-	}
-
-	hnUrl := strings.TrimSuffix(hn.urls[idx].url, "/")
-	url = strings.TrimSuffix(url, "/")
-
-	if hnUrl == url {
+	if idx < len(urls) && urls[idx].url == url {
 		return true, idx
-	} else {
-		return false, 0
 	}
+	return false, 0
 }
 
-func intExists(s []int, el int) bool {
-	i := sort.SearchInts(s, el)
-	if i >= len(s) {
-		return false
-	}
-	return s[i] == el
-}
-
-func keywordFound(keywords []string, title string) bool {
-	for _, line := range keywords {
-		words := strings.Split(line, "\t")
+// filterSource fetches details of all new candidates of the source and
+// puts them into buckets
+func filterSource(res *results, f *fetcher, now time.Time,
+	lists blocklists, conf classConfig) {
 
-		if words[0] == "" || strings.HasPrefix(words[0], "#") {
-			continue
-		}
-
-		if strings.Contains(title, words[0]) {
-			if blockOverride(words, title) {
-				continue
-			} else {
-				return true
-			}
+	var ids []string
+	for _, id := range res.candidates {
+		if !strExists(res.processedIDs, id) {
+			ids = append(ids, id)
 		}
 	}
-	return false
-}
 
-func blockOverride(words []string, title string) bool {
-	for _, word := range words[1:] {
-		if word[0] != '!' {
-			errExit(errors.New(""), "incorrect keyword: "+word)
-		}
-		word = strings.TrimPrefix(word, "!")
+	runPool(f.ctx, f.workers, len(ids), func(i int) {
+		id := ids[i]
+		story, err := res.source.Story(f, id, now)
 
-		if strings.Contains(title, word) {
-			return true
-		} else {
-			continue
+		MU.Lock()
+		defer MU.Unlock()
+		if err != nil {
+			res.failed[id] = err
+			return
 		}
-	}
-	return false
-}
+		story.Reason = storyReason(story, lists, conf, nil)
+		bucket := story.Reason.bucket
+		debug("%s %s %s: %s\n", res.source.Name(), bucket, id,
+			story.Title)
+		res.stories[bucket] = append(res.stories[bucket], story)
+	})
 
-func blockDomain(domains []string, domain string) bool {
-	for _, blockedDomain := range domains {
-		switch {
-		case blockedDomain == "":
-			continue
-		case strings.HasPrefix(blockedDomain, "*"):
-			blockedDomain = strings.TrimPrefix(blockedDomain, "*")
-			if strings.HasSuffix(domain, blockedDomain) {
-				return true
+	// stories come in the order they were fetched, sort them so the logs
+	// are the same on every run
+	for _, stories := range res.stories {
+		sort.Slice(stories, func(i, j int) bool {
+			if stories[i].Time.Equal(stories[j].Time) {
+				return stories[i].ID < stories[j].ID
 			}
-		case domain == blockedDomain:
-			return true
-		}
+			return stories[i].Time.Before(stories[j].Time)
+		})
 	}
-	return false
-}
-
-func getHnStoryIDs(client *http.Client, hn *hnResults) {
-	var topIDs, bestIDs []int
-	urlTop := "https://hacker-news.firebaseio.com/v0/topstories.json"
-	urlBest := "https://hacker-news.firebaseio.com/v0/beststories.json"
-
-	req, err := http.NewRequest("GET", urlTop, nil)
-	errExit(err, "error: cannot prepare a request")
-	req.Close = true
-	resp, err := client.Do(req)
-	errExit(err, "error: cannot make a request")
-
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	err = json.Unmarshal(body, &topIDs)
-	errExit(err, "error: cannot parse json")
-
-	req, err = http.NewRequest("GET", urlBest, nil)
-	errExit(err, "error: cannot prepare a request")
-	req.Close = true
-	resp, err = client.Do(req)
-	errExit(err, "error: cannot make a request")
-
-	body, err = ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	err = json.Unmarshal(body, &bestIDs)
-	errExit(err, "error: cannot parse json")
-
-	hn.storyIDs = append(topIDs, bestIDs...)
-	sort.Ints(hn.storyIDs)
-	hn.storyIDs = uniqueInts(hn.storyIDs)
 }
 
-func getLrsStories(client *http.Client, now time.Time) []lrsStory {
-
-	var storiesHot, storiesNew []lrsStory
-	urlHot := "https://lobste.rs/hottest.json"
-	urlNew := "https://lobste.rs/newest.json"
-
-	req, err := http.NewRequest("GET", urlHot, nil)
-	errExit(err, "error: cannot prepare a request")
-	req.Close = true
-	resp, err := client.Do(req)
-	errExit(err, "error: cannot make a request")
-
-	body, err := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	err = json.Unmarshal(body, &storiesHot)
-	errExit(err, "error: cannot parse json")
+// storyReason returns the first rule that matches the story together with
+// the bucket the story belongs to; a reason already set by the source wins;
+// every step is printed to t, which is nil except for 'explain'
+func storyReason(story newsStory, lists blocklists, conf classConfig,
+	t *tracer) reason {
 
-	req, err = http.NewRequest("GET", urlNew, nil)
-	errExit(err, "error: cannot prepare a request")
-	req.Close = true
-	resp, err = client.Do(req)
-	errExit(err, "error: cannot make a request")
-
-	body, err = ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	err = json.Unmarshal(body, &storiesNew)
-	errExit(err, "error: cannot parse json")
-
-	stories := append(storiesHot, storiesNew...)
-
-	for i, story := range stories {
-		if story.Url == "" {
-			(&stories[i]).Url = story.LrsUrl
-			(&stories[i]).Domain = "lobste.rs"
-		} else {
-			(&stories[i]).Domain = urlToDomain(story.Url)
-		}
-
-		layout := "2006-01-02T15:04:05.999999999Z07:00"
-		t, err := time.Parse(layout, story.TimeS)
-		errExit(err, "error: cannot parse time")
-		local, _ := time.LoadLocation("Local")
-
-		(&stories[i]).Time = t.In(local)
-		(&stories[i]).Hours = int(now.Sub(t.In(local)).Hours())
+	if story.Reason.bucket != "" {
+		t.printf("rejected by the source: %s\n", story.Reason.pattern)
+		return story.Reason
 	}
 
-	return stories
-}
-
-func uniqueInts(ints []int) []int {
-	j := 1
-	for i := 1; i < len(ints); i++ {
-		if ints[i] != ints[i-1] {
-			ints[j] = ints[i]
-			j++
-		}
+	in := ruleInput{
+		title:    story.Title,
+		domain:   story.Domain,
+		author:   story.By,
+		score:    story.Score,
+		comments: story.Comments,
+		age:      story.Hours,
+		tags:     story.Tags,
 	}
-	return ints[:j]
-}
-
-func urlToDomain(url string) string {
-	urlSplit := strings.Split(url, "/")
-	domain := urlSplit[2]
-
-	if (domain == "github.com" || domain == "gitlab.com") &&
-		len(urlSplit) > 3 {
-
-		domain += "/" + urlSplit[3]
+	blocked, r := blockReason(story.Source, in, lists, conf, t)
+	if blocked {
+		return r
 	}
 
-	prefixes := []string{"git.", "www.", "engineering."}
-	for _, p := range prefixes {
-		dots := len(strings.Split(domain, "."))
-		if dots > 1 && strings.HasPrefix(domain, p) {
-			domain = strings.TrimPrefix(domain, p)
-		}
+	fields := map[string]int{
+		"hours":    story.Hours,
+		"score":    story.Score,
+		"comments": story.Comments,
+		"scoreavg": story.ScoreAvg,
 	}
+	rule := matchClassRule(conf, story.Source, fields, t)
 
-	return domain
+	if rule.line == 0 {
+		return reason{bucket: rule.bucket, pattern: rule.text}
+	}
+	return reason{bucket: rule.bucket, file: "classify.rules",
+		line: rule.line, pattern: rule.text}
 }
 
-func getStory(id int, client *http.Client, now time.Time) hnStory {
-	var story hnStory
+// blockReason checks the story against the blocklist rules the source has
+// opted into in classify.rules
+func blockReason(source string, in ruleInput, lists blocklists,
+	conf classConfig, t *tracer) (bool, reason) {
 
-	url := "https://hacker-news.firebaseio.com/v0/item/" +
-		strconv.Itoa(id) + ".json"
-
-	req, err := http.NewRequest("GET", url, nil)
-	req.Close = true
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal(err)
-	}
-	body, _ := ioutil.ReadAll(resp.Body)
-	resp.Body.Close()
-	err = json.Unmarshal(body, &story)
+	var blocked bool
+	var r reason
 
-	story.By = strings.Replace(story.By, "\t", " ", -1)
-	story.Title = strings.Replace(story.Title, "\t", " ", -1)
+	t.printf("blocklist rules of %s: %s\n", source,
+		strings.Join(conf.filters[source], " "))
 
-	if story.Url == "" {
-		story.Url = "https://news.ycombinator.com/item?id=" +
-			strconv.Itoa(id)
+	if conf.filtersOn(source, "domains") {
+		blocked, r = blockDomain(lists.domains, in.domain)
+		t.match("domains", blocked, r, in.domain)
 	}
-	story.Domain = urlToDomain(story.Url)
-	story.Time = time.Unix(story.TimeI, 0)
-	story.Hours = int(now.Sub(story.Time).Hours())
-	if story.Hours == 0 {
-		story.Hours = 1
+	if !blocked && conf.filtersOn(source, "users") {
+		blocked, r = blockUser(lists.users, in.author)
+		t.match("users", blocked, r, in.author)
 	}
-	story.ScoreAvg = story.Score / story.Hours
-
-	return story
-}
-
-func filterHn(hn *hnResults, client *http.Client, now time.Time,
-	progDir string) {
-
-	wg := sync.WaitGroup{}
-
-	blockedDomains := readBlockedDomains(progDir)
-	blockedKeywords := readBlockedKeywords(progDir)
-
-	for _, id := range hn.storyIDs {
-		time.Sleep(10*time.Millisecond)
-
-		if intExists(hn.processedIDs, id) {
-			continue
-		}
-
-		wg.Add(1)
-
-		go func(id int) {
-			story := getStory(id, client, now)
-			MU.Lock()
-			classifyStory(story,
-				blockedDomains, blockedKeywords, hn)
-			MU.Unlock()
-			wg.Done()
-		}(id)
+	if !blocked && conf.filtersOn(source, "keywords") {
+		t.printf("keywords:\n")
+		blocked, r = keywordFound(lists.keywords, in, t)
+	}
+	if !blocked && conf.filtersOn(source, "tags") {
+		t.printf("tags:\n")
+		blocked, r = keywordFound(lists.tags, in, t)
 	}
 
-	wg.Wait()
-
-	sort.Slice(hn.mainStories, func(i, j int) bool {
-		return hn.mainStories[i].ID <= hn.mainStories[j].ID
-	})
-}
-
-func classifyStory(story hnStory, blockedDomains, blockedKeywords []string,
-	hn *hnResults) {
-
-	switch {
-	case story.Type != "story":
-		hn.blockedStories = append(hn.blockedStories, story)
-
-	case blockDomain(blockedDomains, story.Domain):
-		hn.blockedStories = append(hn.blockedStories, story)
-
-	case keywordFound(blockedKeywords, story.Title):
-		hn.blockedStories = append(hn.blockedStories, story)
-
-	case story.Hours > 72 && story.Score >= 100:
-		hn.mainStories = append(hn.mainStories, story)
-
-	case story.Comments >= 40:
-		hn.mainStories = append(hn.mainStories, story)
-
-	case story.Hours > 72 && story.Score < 100:
-		hn.permaLowStories = append(hn.permaLowStories, story)
-
-	case story.Hours > 36 && story.Score < 50:
-		hn.permaLowStories = append(hn.permaLowStories, story)
-
-	case story.Hours > 24 && story.Score < 20:
-		hn.permaLowStories = append(hn.permaLowStories, story)
-
-	case story.Hours > 12 && story.Score < 10:
-		hn.permaLowStories = append(hn.permaLowStories, story)
-
-	case story.Score < 100 && story.ScoreAvg < 20:
-		hn.lowStories = append(hn.lowStories, story)
-
-	default:
-		hn.mainStories = append(hn.mainStories, story)
+	if blocked {
+		r.bucket = "blocked"
 	}
+	return blocked, r
 }
 
-func filterLrs(lrsStories []lrsStory, lrsProcessedIDs *[]string) []lrsStory {
-	var result []lrsStory
+// logStories appends stories to <source>_<bucket>.tsv files; stories in the
+// low bucket go to a temporary file and aren't marked as processed
+func logStories(res *results, progDir string) {
+	name := res.source.Name()
 
-	for _, story := range lrsStories {
-		if strExists(*lrsProcessedIDs, story.ID) {
-			continue
-		}
-		if story.Score > 20 || story.Comments > 5 {
-			result = append(result, story)
-			*lrsProcessedIDs = append(*lrsProcessedIDs, story.ID)
-			// expensive; fix if processing slows down
-			sort.Strings(*lrsProcessedIDs)
+	for _, bucket := range classBuckets {
+		if bucket == "low" {
+			storiesToFile(progDir, name, name+"_low.tsv.tmp",
+				res.stories[bucket], false)
+		} else {
+			storiesToFile(progDir, name, name+"_"+bucket+".tsv",
+				res.stories[bucket], true)
 		}
 	}
-
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].Hours >= result[j].Hours
-	})
-
-	return result
 }
 
-func logHnStories(hn *hnResults, progDir string) {
-	storiesToFile(progDir, "hn_main.tsv", hn.mainStories, true)
-	storiesToFile(progDir, "hn_blocked.tsv", hn.blockedStories, true)
-	storiesToFile(progDir, "hn_permalow.tsv", hn.permaLowStories, true)
-	storiesToFile(progDir, "hn_low.tsv.tmp", hn.lowStories, false)
-}
+func storiesToFile(progDir, source, file string, stories []newsStory,
+	logID bool) {
 
-func storiesToFile(progDir, file string, stories []hnStory, logID bool) {
 	fdOpts := os.O_CREATE | os.O_APPEND | os.O_WRONLY
 
 	fd, err := os.OpenFile(progDir+file, fdOpts, 0644)
 	errExit(err, "error: cannot create file")
 	defer fd.Close()
 
-	fdIDs, err := os.OpenFile(progDir+"hn_processed_ids", fdOpts, 0644)
+	idsFile := progDir + source + "_processed_ids"
+	fdIDs, err := os.OpenFile(idsFile, fdOpts, 0644)
 	errExit(err, "error: cannot create file")
 	defer fdIDs.Close()
 
 	for _, story := range stories {
-		fmt.Fprintln(fd, logHnLine(story))
+		fmt.Fprintln(fd, logLine(story))
 		if logID {
 			fmt.Fprintln(fdIDs, story.ID)
 		}
 	}
 }
 
-func logLrsStories(lrsStories []lrsStory, progDir string) {
-	fdOpts := os.O_CREATE | os.O_APPEND | os.O_WRONLY
-
-	fd, err := os.OpenFile(progDir+"lrs_main.tsv", fdOpts, 0644)
-	errExit(err, "error: cannot create file")
-	defer fd.Close()
-
-	fdIDs, err := os.OpenFile(progDir+"lrs_processed_ids", fdOpts, 0644)
-	errExit(err, "error: cannot create file")
-	defer fdIDs.Close()
-
-	for _, story := range lrsStories {
-		fmt.Fprintln(fd, logLrsLine(story))
-		fmt.Fprintln(fdIDs, story.ID)
-	}
-}
-
-func logHnLine(story hnStory) string {
+func logLine(story newsStory) string {
 	return fmt.Sprintf("%s\t"+
 		"%2.2d:%2.2d\t"+
+		"%s\t"+
 		"%d\t"+
 		"%d\t"+
 		"%d\t"+
-		"%d\t"+
+		"%s\t"+
+		"%s\t"+
+		"%s\t"+
 		"%s\t"+
 		"%s\t"+
 		"%s",
@@ -619,51 +519,121 @@ func logHnLine(story hnStory) string {
 		story.By,
 		story.Title,
 		story.Url,
+		logReason(story.Reason),
+		strings.Join(story.Tags, ","),
+		story.CommentsUrl,
 	)
 }
 
-func logLrsLine(story lrsStory) string {
-	return fmt.Sprintf("%s\t"+
-		"%s\t"+
-		"%s\t"+
-		"%s",
-		story.TimeS,
-		story.ID,
-		story.Title,
-		story.Url,
-	)
+func logReason(r reason) string {
+	line := "-"
+	if r.line > 0 {
+		line = strconv.Itoa(r.line)
+	}
+
+	file := r.file
+	if file == "" {
+		file = "-"
+	}
+
+	overrides := strings.Join(r.overrides, " ")
+	if overrides == "" {
+		overrides = "-"
+	}
+
+	return strings.Join([]string{r.bucket, file, line, r.pattern, overrides},
+		"\t")
 }
 
-func prepareHtml(hn *hnResults, lrsStories *[]lrsStory,
-	progDir string, now time.Time) {
+// parseLogLine is the reverse of logLine; lines logged before reasons were
+// recorded get an empty reason
+func parseLogLine(source, line string) (newsStory, error) {
+	var err error
+	story := newsStory{Source: source}
 
-	dt := fmt.Sprintf("%d-%.2d-%.2d_%.2d%.2d",
-		now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute())
-	file := "news_" + dt + ".html"
+	s := strings.Split(line, "\t")
 
-	fdOpts := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
-	fd, err := os.OpenFile(progDir+file, fdOpts, 0644)
-	errExit(err, "error: cannot create file")
-	defer fd.Close()
+	// lobste.rs lines logged before all sources shared the format:
+	// created_at, short_id, title and url
+	if source == "lrs" && len(s) == 4 {
+		return parseLrsLogLine(story, s)
+	}
+
+	// lines logged before scoreavg was added have the title in column 7
+	if len(s) == 8 {
+		s = append(s[:5], append([]string{"0"}, s[5:]...)...)
+	}
+	if len(s) < 9 {
+		return story, errors.New("too few fields in line: " + line)
+	}
 
-	fmt.Fprintln(fd, htmlHeader)
+	story.Time, err = time.ParseInLocation("2006-01-02 15:04",
+		s[0]+" "+s[1], location)
+	if err != nil {
+		return story, err
+	}
+
+	story.ID = s[2]
+	ints := []*int{&story.Hours, &story.Score, &story.ScoreAvg}
+	for i, p := range ints {
+		*p, err = strconv.Atoi(s[i+3])
+		if err != nil {
+			return story, err
+		}
+	}
+
+	story.By = s[6]
+	story.Title = s[7]
+	story.Url = s[8]
+	story.Domain = urlToDomain(story.Url)
+
+	if len(s) >= 14 {
+		story.Reason.bucket = s[9]
+		if s[10] != "-" {
+			story.Reason.file = s[10]
+		}
+		story.Reason.line, _ = strconv.Atoi(s[11])
+		story.Reason.pattern = s[12]
+		if s[13] != "-" {
+			// every override starts with '!', but may contain spaces
+			for _, o := range strings.Split(s[13], " !") {
+				o = "!" + strings.TrimPrefix(o, "!")
+				story.Reason.overrides = append(
+					story.Reason.overrides, o)
+			}
+		}
+	}
 
-	if len(hn.mainStories) > 0 {
-		fmt.Fprintln(fd, "* hacker news\n")
+	if len(s) >= 15 && s[14] != "" {
+		story.Tags = strings.Split(s[14], ",")
 	}
 
-	for _, story := range hn.mainStories {
-		printHnStory(fd, story)
+	if len(s) >= 16 {
+		story.CommentsUrl = s[15]
+	} else if source == "hn" {
+		story.CommentsUrl = hnUrl + "/item?id=" + story.ID
 	}
 
-	if len(*lrsStories) > 0 {
-		fmt.Fprintln(fd, "\n* lobste.rs\n")
+	return story, nil
+}
+
+func parseLrsLogLine(story newsStory, s []string) (newsStory, error) {
+	t, err := time.Parse(time.RFC3339, s[0])
+	if err != nil {
+		return story, err
 	}
-	for _, story := range *lrsStories {
-		printLrsStory(fd, story, hn)
+
+	story.Time = t.In(location)
+	story.ID = s[1]
+	story.Title = s[2]
+	story.Url = s[3]
+	story.Domain = urlToDomain(story.Url)
+	// self posts were logged with the url of the comments
+	if story.Domain == "lobste.rs" {
+		story.CommentsUrl = story.Url
 	}
 
-	fmt.Fprintln(fd, htmlFooter)
+	return story, nil
 }
 
 func isPrevArticle(a article) bool {
@@ -685,59 +655,51 @@ func isPrevArticle(a article) bool {
 	return false
 }
 
-func printHnStory(fd *os.File, story hnStory) {
-	hnItemUrl := "https://news.ycombinator.com/item?id="
-	hnUrl := hnItemUrl + strconv.Itoa(story.ID)
+// readLog reads back stories logged by storiesToFile; a missing file is
+// treated as empty
+func readLog(progDir, source, file string) []newsStory {
+	var stories []newsStory
 
-	printString := fmt.Sprintf("<a href='%s'>%s</a>\n"+
-		"%dh ago, %d points, <a href='%s'>%d comments</a> "+
-		"(<a href='https://news.ycombinator.com/from?site=%s'>"+
-		"%s</a>)\n",
-		story.Url,
-		story.Title,
-		story.Hours,
-		story.Score,
-		hnUrl,
-		story.Comments,
-		story.Domain,
-		story.Domain,
-	)
+	fd, err := os.Open(progDir + file)
+	if err != nil {
+		return stories
+	}
+	defer fd.Close()
 
-	fmt.Fprintln(fd, printString)
-}
+	input := bufio.NewScanner(fd)
+	for input.Scan() {
+		story, err := parseLogLine(source, input.Text())
+		errExit(err, "error: cannot parse "+file)
+		stories = append(stories, story)
+	}
 
-func printLrsStory(fd *os.File, story lrsStory, hn *hnResults) {
-	hnItemUrl := "https://news.ycombinator.com/item?id="
-	hnLink := "-"
+	return stories
+}
 
-	hnExists, idx := urlExists(hn, story.Url)
-	if hnExists {
-		hnUrl := hnItemUrl + strconv.Itoa(hn.urls[idx].id)
-		hnLink = fmt.Sprintf("<a href='%s'>hn</a>", hnUrl)
+func reasonString(r reason) string {
+	if r.bucket == "" {
+		return "unknown (logged before reasons were recorded)"
 	}
 
-	printString := fmt.Sprintf("<a href='%s'>%s</a>\n"+
-		"%dh ago, %d points, <a href='%s'>%d comments</a> "+
-		"(<a href='https://lobste.rs/domain/%s'>%s</a>) (%s)\n",
-		story.Url,
-		story.Title,
-		story.Hours,
-		story.Score,
-		story.LrsUrl,
-		story.Comments,
-		story.Domain,
-		story.Domain,
-		hnLink,
-	)
+	res := r.pattern
+	if r.file != "" {
+		res = fmt.Sprintf("%s:%d '%s'", r.file, r.line, r.pattern)
+	}
+	if len(r.overrides) > 0 {
+		res += " (overrides checked: " +
+			strings.Join(r.overrides, " ") + ")"
+	}
 
-	fmt.Fprintln(fd, printString)
+	return res
 }
 
-func clearTmp(progDir string) {
-	tmpFile := progDir + "hn_low.tsv.tmp"
-	info, _ := os.Stat(tmpFile)
-	if info.Size() > 8*1024*1024 {
-		os.Remove(tmpFile)
+func clearTmp(progDir string, all []*results) {
+	for _, res := range all {
+		tmpFile := progDir + res.source.Name() + "_low.tsv.tmp"
+		info, err := os.Stat(tmpFile)
+		if err == nil && info.Size() > 8*1024*1024 {
+			os.Remove(tmpFile)
+		}
 	}
 }
 
@@ -747,31 +709,3 @@ func errExit(err error, msg string) {
 		log.Fatal(err)
 	}
 }
-
-var htmlHeader string = `<!DOCTYPE html>
-<html>
-<head>
-	<title>news</title>
-	<meta charset="UTF-8">
-</head>
-
-<style>
-	html, pre {	max-width: 750px;
-			margin: 0 auto;
-			line-height: 1.2;
-			color: #bbb;
-			background-color: #000;
-			-webkit-font-smoothing: none;
-			-webkit-text-stroke: 0.3px;
-	}
-	a {		color: #009900;
-			background-color: transparent;
-			text-decoration: underline;
-	}
-</style>
-
-<body><pre>
-`
-
-var htmlFooter string = `</pre></body>
-</html>`
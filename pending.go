@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readPending reads <source>_pending, a list of IDs of stories that couldn't
+// be fetched in previous runs, each with the number of failed tries
+func readPending(progDir, source string) map[string]int {
+	pending := make(map[string]int)
+
+	fd, err := os.Open(progDir + source + "_pending")
+	if os.IsNotExist(err) {
+		return pending
+	}
+	errExit(err, "error: cannot read file")
+	defer fd.Close()
+
+	input := bufio.NewScanner(fd)
+	for i := 1; input.Scan(); i++ {
+		s := strings.Split(input.Text(), "\t")
+		if len(s) != 2 {
+			msg := fmt.Sprintf("%s_pending:%d: incorrect line",
+				source, i)
+			errExit(errors.New(input.Text()), msg)
+		}
+
+		tries, err := strconv.Atoi(s[1])
+		errExit(err, fmt.Sprintf("%s_pending:%d: incorrect line",
+			source, i))
+		pending[s[0]] = tries
+	}
+
+	return pending
+}
+
+// addPending appends pending IDs to the candidates, so stories that failed
+// before are tried again even when the source doesn't list them anymore
+func addPending(res *results) {
+	var ids []string
+	for id := range res.pending {
+		if !strIn(res.candidates, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	res.candidates = append(res.candidates, ids...)
+}
+
+// updatePending writes IDs of stories that failed in this run to
+// <source>_pending; after maxTries failed tries a story is given up on and
+// marked as processed
+func updatePending(res *results, progDir string, maxTries int) {
+	name := res.source.Name()
+	pending := make(map[string]int)
+	var givenUp []string
+
+	// stories that weren't tried in this run, e.g. after Ctrl-C, stay
+	done := make(map[string]bool)
+	for _, stories := range res.stories {
+		for _, story := range stories {
+			done[story.ID] = true
+		}
+	}
+	for id, tries := range res.pending {
+		if _, failed := res.failed[id]; !failed && !done[id] {
+			pending[id] = tries
+		}
+	}
+
+	for id, err := range res.failed {
+		tries := res.pending[id]
+		if !notTried(err) {
+			tries++
+		}
+
+		if tries >= maxTries {
+			givenUp = append(givenUp, id)
+			continue
+		}
+		pending[id] = tries
+	}
+	sort.Strings(givenUp)
+	res.pending = pending
+
+	fdOpts := os.O_CREATE | os.O_APPEND | os.O_WRONLY
+	fdIDs, err := os.OpenFile(progDir+name+"_processed_ids", fdOpts, 0644)
+	errExit(err, "error: cannot create file")
+	defer fdIDs.Close()
+
+	for _, id := range givenUp {
+		info("giving up on %s story %s after %d tries\n",
+			res.source.Title(), id, maxTries)
+		fmt.Fprintln(fdIDs, id)
+	}
+
+	file := progDir + name + "_pending"
+	if len(pending) == 0 {
+		err = os.Remove(file)
+		if !os.IsNotExist(err) {
+			errExit(err, "error: cannot remove file")
+		}
+		return
+	}
+
+	var ids []string
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	fdOpts = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	fd, err := os.OpenFile(file, fdOpts, 0644)
+	errExit(err, "error: cannot create file")
+	defer fd.Close()
+
+	for _, id := range ids {
+		fmt.Fprintf(fd, "%s\t%d\n", id, pending[id])
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ruleTest is a line of rules.tests: a story and whether the blocklists
+// should block it
+type ruleTest struct {
+	line    int
+	text    string
+	verdict string
+	story   newsStory
+}
+
+var ruleVerdicts = []string{"blocked", "pass"}
+
+// rulesCommand is the 'rules' command, its subcommands check the rules
+func rulesCommand(c cli, args []string) {
+	subcommands := map[string]func(c cli, args []string){
+		"test":     testRules,
+		"backtest": backtestRules,
+		"lint":     lintRules,
+	}
+
+	if len(args) == 0 {
+		errExit(errors.New("no subcommand"), "error: expected "+
+			"'rules test', 'rules backtest' or 'rules lint'")
+	}
+	run, ok := subcommands[args[0]]
+	if !ok {
+		errExit(errors.New(args[0]), "error: unknown rules subcommand")
+	}
+	run(c, args[1:])
+}
+
+// testRules is 'rules test': every case of rules.tests is checked against
+// the current blocklists, the cases that got another verdict are printed
+// as a diff and the command fails
+func testRules(c cli, args []string) {
+	file := c.progDir + "rules.tests"
+	if len(args) > 0 {
+		file = args[0]
+	}
+
+	tests, err := readRuleTests(file)
+	errExit(err, "error: incorrect test case")
+
+	conf := readClassRules(c.progDir)
+	lists := readBlocklists(c.progDir)
+
+	failed := 0
+	for _, test := range tests {
+		in := ruleInput{
+			title:  test.story.Title,
+			domain: test.story.Domain,
+			author: test.story.By,
+			tags:   test.story.Tags,
+		}
+		blocked, r := blockReason(test.story.Source, in, lists, conf,
+			nil)
+
+		verdict := "pass"
+		by := ""
+		if blocked {
+			verdict = "blocked"
+			by = " by " + reasonString(r)
+		}
+		if verdict == test.verdict {
+			continue
+		}
+
+		failed++
+		fmt.Printf("%s:%d: expected %s, got %s%s\n", file, test.line,
+			test.verdict, verdict, by)
+		fmt.Printf("-%s\n+%s\n", test.text, verdict+
+			strings.TrimPrefix(test.text, test.verdict))
+	}
+
+	fmt.Printf("%d tests, %d failed\n", len(tests), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readRuleTests parses rules.tests; every line is a verdict, 'blocked' or
+// 'pass', followed by tab-separated fields of the story, e.g.
+//
+//	blocked	title=Startup raises $10M	domain=techcrunch.com
+//
+// known fields are source (hn by default), title, url, domain (taken from
+// the url if not set), author and tags (comma-separated)
+func readRuleTests(file string) ([]ruleTest, error) {
+	var tests []ruleTest
+
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	input := bufio.NewScanner(fd)
+	for i := 1; input.Scan(); i++ {
+		line := input.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		test, err := parseRuleTest(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, i, err)
+		}
+		test.line = i
+		tests = append(tests, test)
+	}
+
+	return tests, input.Err()
+}
+
+func parseRuleTest(line string) (ruleTest, error) {
+	test := ruleTest{text: line, story: newsStory{Source: "hn"}}
+
+	fields := strings.Split(line, "\t")
+	test.verdict = fields[0]
+	if !strIn(ruleVerdicts, test.verdict) {
+		return test, fmt.Errorf("unknown verdict '%s', expected %s",
+			test.verdict, strings.Join(ruleVerdicts, " or "))
+	}
+
+	story := &test.story
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return test, fmt.Errorf("expected field=value, got '%s'",
+				f)
+		}
+
+		switch kv[0] {
+		case "source":
+			story.Source = kv[1]
+			if _, ok := sourceByName(kv[1]); !ok {
+				return test, fmt.Errorf("unknown source '%s'",
+					kv[1])
+			}
+		case "title":
+			story.Title = kv[1]
+		case "url":
+			story.Url = kv[1]
+			if story.Domain == "" && strings.Contains(kv[1], "://") {
+				story.Domain = urlToDomain(kv[1])
+			}
+		case "domain":
+			story.Domain = normalizeDomainEntry(kv[1])
+		case "author":
+			story.By = kv[1]
+		case "tags":
+			story.Tags = strings.Split(kv[1], ",")
+		default:
+			return test, fmt.Errorf("unknown field '%s'", kv[0])
+		}
+	}
+
+	return test, nil
+}
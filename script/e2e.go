@@ -0,0 +1,287 @@
+// e2e - end-to-end test of newsfilter against a fake HN, lobste.rs, reddit and
+// feed server
+//
+// usage:
+// go run script/e2e.go [-update] [-bin ./newsfilter]
+// go run script/e2e.go -serve localhost:8080
+//
+// info:
+// the fake server serves files from testdata/e2e/server, e.g.
+// /v0/topstories.json, /v0/item/1.json, /lrs/hottest.json or
+// /r/programming/top.json; files in /feeds/ get an ETag made of their name,
+// so conditional GETs get a 304
+//
+// newsfilter runs with HOME set to a temp dir, once for every time in RUNS,
+// its progDir gets the files from testdata/e2e/progdir with $SERVER replaced
+// by the url of the fake server; from the second run on, files in
+// testdata/e2e/server2 are served instead of the ones in testdata/e2e/server,
+// e.g. the HN item that was a 404 before; after every run all the files
+// written by newsfilter and its output are compared with
+// testdata/e2e/golden/<run>, after the temp dir and the server url are
+// replaced; -update writes the golden files instead
+//
+// -serve only runs the fake server, e.g. to use newsfilter offline with
+// 'newsfilter -hn-api-url http://localhost:8080/v0 -lrs-url ...'
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const TESTDIR = "testdata/e2e"
+
+// RUNS are the clock of the runs of newsfilter; the second run checks the
+// state kept between runs: processed IDs, pending stories, digest.tsv and
+// the ETags of the feeds
+var RUNS = []string{"2026-10-01T08:00:00Z", "2026-10-01T14:00:00Z"}
+
+// run is the number of the current run, the fake server reads it
+var run int32
+
+// files in progDir that newsfilter only reads
+var INPUTS = []string{"blocked.domains", "blocked.keywords", "feeds",
+	"newsfilter.conf"}
+
+func main() {
+	update := flag.Bool("update", false, "write golden files")
+	bin := flag.String("bin", "./newsfilter", "newsfilter binary")
+	serve := flag.String("serve", "", "only run the fake server on the "+
+		"address")
+	flag.Parse()
+
+	if *serve != "" {
+		fmt.Println("serving " + TESTDIR + "/server on " + *serve)
+		log.Fatal(http.ListenAndServe(*serve, fakeServer()))
+	}
+
+	srv := httptest.NewServer(fakeServer())
+	defer srv.Close()
+
+	homeDir, err := os.MkdirTemp("", "newsfilter-e2e")
+	errExit(err, "error: cannot create temp dir")
+	defer os.RemoveAll(homeDir)
+
+	progDir := homeDir + "/.local/share/newsfilter/"
+	err = os.MkdirAll(progDir, 0755)
+	errExit(err, "error: cannot create dir")
+
+	for _, file := range INPUTS {
+		b, err := os.ReadFile(TESTDIR + "/progdir/" + file)
+		errExit(err, "error: cannot read file")
+		b = bytes.Replace(b, []byte("$SERVER"), []byte(srv.URL), -1)
+		err = os.WriteFile(progDir+file, b, 0644)
+		errExit(err, "error: cannot write file")
+	}
+
+	ok := true
+	for i, now := range RUNS {
+		atomic.StoreInt32(&run, int32(i+1))
+		out := runNewsfilter(*bin, homeDir, srv.URL, now)
+
+		got := map[string]string{"stdout": out}
+		entries, err := os.ReadDir(progDir)
+		errExit(err, "error: cannot read dir")
+		for _, e := range entries {
+			if strIn(INPUTS, e.Name()) {
+				continue
+			}
+			b, err := os.ReadFile(progDir + e.Name())
+			errExit(err, "error: cannot read file")
+			got[e.Name()] = string(b)
+		}
+
+		got = normalize(got, progDir, srv.URL)
+
+		dir := fmt.Sprintf("%s/golden/%d/", TESTDIR, i+1)
+		if *update {
+			writeGolden(dir, got)
+		} else if !compareGolden(dir, got) {
+			ok = false
+		}
+	}
+
+	if *update {
+		return
+	}
+	if !ok {
+		os.Exit(1)
+	}
+	fmt.Println("ok")
+}
+
+// fakeServer serves the fixtures; a missing file is a 404
+func fakeServer() http.Handler {
+	// serverFile returns the fixture of the url path for the current run
+	serverFile := func(p string) string {
+		file := TESTDIR + "/server2" + path.Clean("/"+p)
+		if atomic.LoadInt32(&run) >= 2 {
+			if _, err := os.Stat(file); err == nil {
+				return file
+			}
+		}
+		return TESTDIR + "/server" + path.Clean("/"+p)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		file := serverFile(r.URL.Path)
+		if fi, err := os.Stat(file); err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, file)
+	})
+	mux.HandleFunc("/feeds/", func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		b, err := os.ReadFile(serverFile("/feeds/" + name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// no modification time, so there's no Last-Modified header,
+		// which would change with every checkout
+		w.Header().Set("ETag", `"`+name+`"`)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+	})
+
+	return mux
+}
+
+func runNewsfilter(bin, homeDir, srvUrl, now string) string {
+	cmd := exec.Command(bin,
+		"-hn-api-url", srvUrl+"/v0",
+		"-hn-url", "https://news.ycombinator.com",
+		"-lrs-url", srvUrl+"/lrs",
+		"-reddit-url", srvUrl,
+		"-now", now,
+		"-timezone", "UTC")
+	cmd.Env = append(os.Environ(), "HOME="+homeDir)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		os.Stdout.Write(out)
+	}
+	errExit(err, "error: newsfilter failed")
+
+	return string(out)
+}
+
+// normalize replaces the temp dir and the port of the server
+func normalize(got map[string]string, progDir, srvUrl string) map[string]string {
+	res := make(map[string]string)
+
+	for name, text := range got {
+		text = strings.Replace(text, progDir, "$PROGDIR/", -1)
+		text = strings.Replace(text, srvUrl, "$SERVER", -1)
+		res[name] = text
+	}
+
+	return res
+}
+
+func writeGolden(dir string, got map[string]string) {
+	err := os.MkdirAll(dir, 0755)
+	errExit(err, "error: cannot create dir")
+	old, err := os.ReadDir(dir)
+	errExit(err, "error: cannot read dir")
+	for _, e := range old {
+		err = os.Remove(dir + e.Name())
+		errExit(err, "error: cannot remove file")
+	}
+
+	for name, text := range got {
+		err = os.WriteFile(dir+name, []byte(text), 0644)
+		errExit(err, "error: cannot write file")
+		fmt.Println(dir + name)
+	}
+}
+
+// compareGolden prints the first differing line of every file that's not
+// the same as its golden file
+func compareGolden(dir string, got map[string]string) bool {
+	ok := true
+
+	var names []string
+	entries, err := os.ReadDir(dir)
+	errExit(err, "error: cannot read dir")
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	for name := range got {
+		if !strIn(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b, err := os.ReadFile(dir + name)
+		text, found := got[name]
+		switch {
+		case os.IsNotExist(err):
+			fmt.Printf("%s%s: not expected\n", dir, name)
+			ok = false
+		case err != nil:
+			errExit(err, "error: cannot read file")
+		case !found:
+			fmt.Printf("%s%s: not written\n", dir, name)
+			ok = false
+		case !bytes.Equal(b, []byte(text)):
+			fmt.Printf("%s%s: %s\n", dir, name,
+				firstDiff(string(b), text))
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+func firstDiff(want, got string) string {
+	w := strings.Split(want, "\n")
+	g := strings.Split(got, "\n")
+
+	for i := 0; i < len(w) || i < len(g); i++ {
+		var wl, gl string
+		if i < len(w) {
+			wl = w[i]
+		}
+		if i < len(g) {
+			gl = g[i]
+		}
+		if wl != gl {
+			return fmt.Sprintf("line %d\n  want: %q\n  got:  %q",
+				i+1, wl, gl)
+		}
+	}
+	return "differs"
+}
+
+func strIn(s []string, el string) bool {
+	for _, e := range s {
+		if e == el {
+			return true
+		}
+	}
+	return false
+}
+
+func errExit(err error, msg string) {
+	if err != nil {
+		log.Println("\n * " + msg)
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// serveDigest is the 'serve' command: a small http server with the html
+// pages and feeds from progDir; '/' is the newest digest page, nothing else
+// from progDir is served
+func serveDigest(c cli, args []string) {
+	addr := "localhost:8080"
+	if len(args) > 1 {
+		errExit(errors.New(strings.Join(args, " ")),
+			"error: unexpected arguments")
+	}
+	if len(args) == 1 {
+		addr = args[0]
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		file := strings.TrimPrefix(r.URL.Path, "/")
+		if file == "" {
+			file = newestDigest(c.progDir)
+		}
+
+		if !servedFile(file) {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch filepath.Ext(file) {
+		case ".atom":
+			w.Header().Set("Content-Type", "application/atom+xml")
+		case ".rss":
+			w.Header().Set("Content-Type", "application/rss+xml")
+		}
+		http.ServeFile(w, r, c.progDir+file)
+	})
+
+	info("serving %s on http://%s/\n", c.progDir, addr)
+	errExit(http.ListenAndServe(addr, nil), "error: cannot serve")
+}
+
+// servedFile reports if the file name is one of the outputs of newsfilter
+func servedFile(file string) bool {
+	if strings.Contains(file, "/") {
+		return false
+	}
+	if file == "newsfilter.atom" || file == "newsfilter.rss" {
+		return true
+	}
+
+	for _, pattern := range []string{"news_*.html", "blocked_*.html"} {
+		if ok, _ := filepath.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// newestDigest returns the name of the newest news_*.html file; the names
+// sort by date
+func newestDigest(progDir string) string {
+	matches, err := filepath.Glob(progDir + "news_*.html")
+	errExit(err, "error: cannot list files")
+	if len(matches) == 0 {
+		return ""
+	}
+
+	sort.Strings(matches)
+	return filepath.Base(matches[len(matches)-1])
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Source is a site the stories are fetched from; every source lives in its
+// own source_<name>.go file and registers itself with registerSource() in
+// an init() function
+type Source interface {
+	// Name is the short name of the source used in classify.rules and
+	// newsfilter.conf, as a prefix of log files and as the namespace of
+	// processed IDs, e.g. 'hn' for hn_main.tsv and hn_processed_ids
+	Name() string
+
+	// Title is the heading of the source section in the digest
+	Title() string
+
+	// Filters returns kinds of blocklist rules used when there's no
+	// 'filter' line for the source in classify.rules
+	Filters() []string
+
+	// Candidates returns IDs of all stories currently listed by the
+	// source; already processed IDs are skipped by the caller
+	Candidates(f *fetcher) ([]string, error)
+
+	// Story fetches details of a single candidate; a source can reject a
+	// story on its own by setting Reason of the returned story
+	Story(f *fetcher, id string, now time.Time) (newsStory, error)
+}
+
+// sourceSetup is implemented by sources that need files or settings from
+// progDir; Setup is called before Candidates
+type sourceSetup interface {
+	Setup(progDir string, settings config) error
+}
+
+// sourceCommitter is implemented by sources that keep state between runs;
+// Commit is called after all the stories are logged, unless the run was
+// interrupted
+type sourceCommitter interface {
+	Commit() error
+}
+
+// newsStory is a story from any source mapped to a common model; it's what
+// gets classified, logged and rendered
+type newsStory struct {
+	Source      string
+	ID          string
+	By          string
+	Score       int
+	Comments    int
+	Title       string
+	Url         string
+	Domain      string
+	Tags        []string
+	ScoreAvg    int
+	Time        time.Time
+	Hours       int
+	CommentsUrl string
+	DomainUrl   string
+	Reason      reason
+
+	// Unscored is set for sources without score and comment counts
+	Unscored bool
+}
+
+var registeredSources []Source
+
+func registerSource(s Source) {
+	registeredSources = append(registeredSources, s)
+}
+
+func sourceByName(name string) (Source, bool) {
+	for _, s := range registeredSources {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// sourceNames returns names of all registered sources, sorted
+func sourceNames() []string {
+	var names []string
+	for _, s := range registeredSources {
+		names = append(names, s.Name())
+	}
+	sort.Strings(names)
+
+	return names
+}
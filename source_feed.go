@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// feedSource reads RSS 2.0, RSS 1.0 and Atom feeds listed in the 'feeds'
+// file in progDir, one url per line; ETag and Last-Modified headers of every
+// feed are kept in feed_state, so feeds that didn't change aren't downloaded
+type feedSource struct {
+	progDir string
+	feeds   []string
+	state   map[string]feedState
+	stories map[string]newsStory
+
+	// fresh holds the headers of feeds downloaded in this run and feedIDs
+	// their items; the headers are saved only once all the items are
+	// processed, so no item is lost behind a 304
+	fresh   map[string]feedState
+	feedIDs map[string][]string
+}
+
+type feedState struct {
+	etag         string
+	lastModified string
+}
+
+type feedDoc struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title    string `xml:"title"`
+	Link     string `xml:"link"`
+	Guid     string `xml:"guid"`
+	PubDate  string `xml:"pubDate"`
+	Date     string `xml:"date"`
+	Comments string `xml:"comments"`
+	Author   string `xml:"author"`
+	Creator  string `xml:"creator"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+	Author    struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+}
+
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02",
+}
+
+func init() {
+	registerSource(&feedSource{})
+}
+
+func (*feedSource) Name() string {
+	return "feed"
+}
+
+func (*feedSource) Title() string {
+	return "feeds"
+}
+
+func (*feedSource) Filters() []string {
+	return []string{"domains", "keywords"}
+}
+
+func (s *feedSource) Setup(progDir string, settings config) error {
+	s.progDir = progDir
+	s.feeds = nil
+	s.state = make(map[string]feedState)
+
+	fd, err := os.Open(progDir + "feeds")
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	input := bufio.NewScanner(fd)
+	for input.Scan() {
+		line := strings.TrimSpace(input.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			s.feeds = append(s.feeds, line)
+		}
+	}
+
+	fdState, err := os.Open(progDir + "feed_state")
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer fdState.Close()
+
+	input = bufio.NewScanner(fdState)
+	for input.Scan() {
+		f := strings.Split(input.Text(), "\t")
+		if len(f) == 3 {
+			s.state[f[0]] = feedState{etag: f[1], lastModified: f[2]}
+		}
+	}
+
+	return nil
+}
+
+// Candidates downloads all the feeds; a feed that can't be fetched or
+// parsed is skipped with a warning, so it doesn't stop the others
+func (s *feedSource) Candidates(f *fetcher) ([]string, error) {
+	var ids []string
+	s.stories = make(map[string]newsStory)
+	s.fresh = make(map[string]feedState)
+	s.feedIDs = make(map[string][]string)
+
+	for _, feed := range s.feeds {
+		stories, err := s.fetchFeed(f, feed)
+		if err != nil {
+			log.Printf("warning: skipping feed %s: %v\n", feed, err)
+			continue
+		}
+
+		for _, story := range stories {
+			s.feedIDs[feed] = append(s.feedIDs[feed], story.ID)
+			if _, ok := s.stories[story.ID]; !ok {
+				ids = append(ids, story.ID)
+			}
+			s.stories[story.ID] = story
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (s *feedSource) Story(f *fetcher, id string,
+	now time.Time) (newsStory, error) {
+
+	story, ok := s.stories[id]
+	if !ok {
+		return newsStory{}, errors.New("feed item not listed: " + id)
+	}
+
+	if story.Time.IsZero() {
+		story.Time = now
+	}
+	story.Hours = int(now.Sub(story.Time).Hours())
+	if story.Hours < 0 {
+		story.Hours = 0
+	}
+
+	return story, nil
+}
+
+// Commit saves the feed state; it's called only after all the stories are
+// logged and not after an interrupted run; the new headers of a feed are
+// kept only if all its items are in feed_processed_ids, so low and failed
+// items are downloaded again on the next run
+func (s *feedSource) Commit() error {
+	processed := readProcessedIDs(s.progDir, s.Name())
+	for feed, st := range s.fresh {
+		complete := true
+		for _, id := range s.feedIDs[feed] {
+			if !strExists(processed, id) {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			s.state[feed] = st
+		}
+	}
+
+	var feeds []string
+	for feed := range s.state {
+		feeds = append(feeds, feed)
+	}
+	sort.Strings(feeds)
+
+	fdOpts := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	fd, err := os.OpenFile(s.progDir+"feed_state", fdOpts, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	for _, feed := range feeds {
+		st := s.state[feed]
+		fmt.Fprintf(fd, "%s\t%s\t%s\n", feed, st.etag, st.lastModified)
+	}
+
+	return nil
+}
+
+func (s *feedSource) fetchFeed(f *fetcher,
+	feed string) ([]newsStory, error) {
+
+	req, err := http.NewRequest("GET", feed, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	st := s.state[feed]
+	if st.etag != "" {
+		req.Header.Set("If-None-Match", st.etag)
+	}
+	if st.lastModified != "" {
+		req.Header.Set("If-Modified-Since", st.lastModified)
+	}
+
+	resp, body, err := f.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, errors.New(resp.Status)
+	}
+
+	stories, err := parseFeed(feed, body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.fresh[feed] = feedState{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	return stories, nil
+}
+
+func parseFeed(feed string, body []byte) ([]newsStory, error) {
+	var doc feedDoc
+	var stories []newsStory
+
+	err := xml.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := neturl.Parse(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	items := append(doc.Channel.Items, doc.Items...)
+	for _, item := range items {
+		story := newsStory{
+			Title:       item.Title,
+			Url:         item.Link,
+			ID:          item.Guid,
+			By:          item.Author,
+			CommentsUrl: item.Comments,
+			Time:        parseFeedTime(item.PubDate, item.Date),
+		}
+		if story.By == "" {
+			story.By = item.Creator
+		}
+
+		stories = append(stories, story)
+	}
+
+	for _, entry := range doc.Entries {
+		story := newsStory{
+			Title: entry.Title,
+			ID:    entry.ID,
+			By:    entry.Author.Name,
+			Time:  parseFeedTime(entry.Published, entry.Updated),
+		}
+		for _, l := range entry.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				story.Url = l.Href
+				break
+			}
+		}
+
+		stories = append(stories, story)
+	}
+
+	var res []newsStory
+	for _, story := range stories {
+		link, err := base.Parse(strings.TrimSpace(story.Url))
+		if err != nil || link.Host == "" {
+			continue
+		}
+
+		story.Source = "feed"
+		story.Url = link.String()
+		// guids like '42' are unique only within their feed, so they
+		// get the feed url in front; url guids and links are kept in
+		// the form of canonicalUrl, so e.g. an added utm_source
+		// doesn't make an item new
+		story.ID = oneLine(story.ID)
+		switch {
+		case story.ID == "":
+			story.ID = canonicalUrl(story.Url)
+		case strings.Contains(story.ID, "://"):
+			story.ID = canonicalUrl(story.ID)
+		default:
+			story.ID = feed + "#" + story.ID
+		}
+		story.Title = oneLine(story.Title)
+		story.By = oneLine(story.By)
+		story.CommentsUrl = oneLine(story.CommentsUrl)
+		story.Domain = urlToDomain(story.Url)
+		story.DomainUrl = link.Scheme + "://" + link.Host
+		story.Unscored = true
+
+		res = append(res, story)
+	}
+
+	return res, nil
+}
+
+// parseFeedTime returns the first of the dates that can be parsed; items
+// without a date get the zero time, replaced with the time of the run by
+// Story()
+func parseFeedTime(dates ...string) time.Time {
+	for _, d := range dates {
+		d = strings.TrimSpace(d)
+		for _, layout := range feedTimeLayouts {
+			t, err := time.Parse(layout, d)
+			if err == nil {
+				return t.In(location)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// oneLine squeezes all whitespace, so the text fits in a log file field
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type hnStory struct {
+	ID       int    `json:"id"`
+	By       string `json:"by"`
+	Score    int    `json:"score"`
+	Comments int    `json:"descendants"`
+	TimeI    int64  `json:"time"`
+	Title    string `json:"title"`
+	Url      string `json:"url"`
+	Type     string `json:"type"`
+}
+
+type hnSource struct{}
+
+func init() {
+	registerSource(hnSource{})
+}
+
+func (hnSource) Name() string {
+	return "hn"
+}
+
+func (hnSource) Title() string {
+	return "hacker news"
+}
+
+func (hnSource) Filters() []string {
+	return []string{"domains", "users", "keywords", "tags"}
+}
+
+func (hnSource) Candidates(f *fetcher) ([]string, error) {
+	var topIDs, bestIDs []int
+	urlTop := hnApiUrl + "/topstories.json"
+	urlBest := hnApiUrl + "/beststories.json"
+
+	err := f.getJSON(urlTop, &topIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.getJSON(urlBest, &bestIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	storyIDs := append(topIDs, bestIDs...)
+	sort.Ints(storyIDs)
+	storyIDs = uniqueInts(storyIDs)
+
+	var ids []string
+	for _, id := range storyIDs {
+		ids = append(ids, strconv.Itoa(id))
+	}
+
+	return ids, nil
+}
+
+func (hnSource) Story(f *fetcher, id string,
+	now time.Time) (newsStory, error) {
+
+	var item hnStory
+
+	url := hnApiUrl + "/item/" + id + ".json"
+	err := f.getJSON(url, &item)
+	if err != nil {
+		return newsStory{}, err
+	}
+
+	// items that don't exist (yet) are returned as 'null'
+	if item.ID == 0 {
+		return newsStory{}, errors.New(url + ": no such item")
+	}
+
+	story := newsStory{
+		Source:   "hn",
+		ID:       id,
+		By:       strings.Replace(item.By, "\t", " ", -1),
+		Score:    item.Score,
+		Comments: item.Comments,
+		Title:    strings.Replace(item.Title, "\t", " ", -1),
+		Url:      item.Url,
+	}
+
+	if story.Url == "" {
+		story.Url = hnUrl + "/item?id=" + id
+	}
+	story.Domain = urlToDomain(story.Url)
+	story.Time = time.Unix(item.TimeI, 0).In(location)
+	story.Hours = int(now.Sub(story.Time).Hours())
+	if story.Hours == 0 {
+		story.Hours = 1
+	}
+	story.ScoreAvg = story.Score / story.Hours
+
+	story.CommentsUrl = hnUrl + "/item?id=" + id
+	story.DomainUrl = hnUrl + "/from?site=" + hnSite(story.Domain)
+
+	if item.Type != "story" {
+		story.Reason = reason{bucket: "blocked", pattern: "type != story"}
+	}
+
+	return story, nil
+}
+
+func uniqueInts(ints []int) []int {
+	if len(ints) == 0 {
+		return ints
+	}
+
+	j := 1
+	for i := 1; i < len(ints); i++ {
+		if ints[i] != ints[i-1] {
+			ints[j] = ints[i]
+			j++
+		}
+	}
+	return ints[:j]
+}
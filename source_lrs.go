@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+type lrsStory struct {
+	ID        string   `json:"short_id"`
+	TimeS     string   `json:"created_at"`
+	Title     string   `json:"title"`
+	Url       string   `json:"url"`
+	Score     int      `json:"score"`
+	Comments  int      `json:"comment_count"`
+	LrsUrl    string   `json:"comments_url"`
+	Submitter lrsUser  `json:"submitter_user"`
+	Tags      []string `json:"tags"`
+}
+
+// lrsUser is the submitter of a lobste.rs story; older versions of the API
+// return an object with the username instead of a plain string
+type lrsUser string
+
+func (u *lrsUser) UnmarshalJSON(b []byte) error {
+	var user struct {
+		Username string `json:"username"`
+	}
+
+	if bytes.HasPrefix(b, []byte("{")) {
+		err := json.Unmarshal(b, &user)
+		*u = lrsUser(user.Username)
+		return err
+	}
+
+	return json.Unmarshal(b, (*string)(u))
+}
+
+// lrsSource gets full stories with the listings, so Story() only looks them
+// up in the listings fetched by Candidates()
+type lrsSource struct {
+	stories map[string]lrsStory
+}
+
+func init() {
+	registerSource(&lrsSource{})
+}
+
+func (*lrsSource) Name() string {
+	return "lrs"
+}
+
+func (*lrsSource) Title() string {
+	return "lobste.rs"
+}
+
+func (*lrsSource) Filters() []string {
+	return []string{"tags"}
+}
+
+func (s *lrsSource) Candidates(f *fetcher) ([]string, error) {
+	var storiesHot, storiesNew []lrsStory
+	urlHot := lrsUrl + "/hottest.json"
+	urlNew := lrsUrl + "/newest.json"
+
+	err := f.getJSON(urlHot, &storiesHot)
+	if err != nil {
+		return nil, err
+	}
+
+	err = f.getJSON(urlNew, &storiesNew)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	s.stories = make(map[string]lrsStory)
+	for _, story := range append(storiesHot, storiesNew...) {
+		if _, ok := s.stories[story.ID]; !ok {
+			ids = append(ids, story.ID)
+		}
+		s.stories[story.ID] = story
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (s *lrsSource) Story(f *fetcher, id string,
+	now time.Time) (newsStory, error) {
+
+	item, ok := s.stories[id]
+	if !ok {
+		return newsStory{}, errors.New("lobste.rs story not listed: " + id)
+	}
+
+	story := newsStory{
+		Source:      "lrs",
+		ID:          id,
+		By:          strings.Replace(string(item.Submitter), "\t", " ", -1),
+		Score:       item.Score,
+		Comments:    item.Comments,
+		Title:       strings.Replace(item.Title, "\t", " ", -1),
+		Url:         item.Url,
+		Tags:        item.Tags,
+		CommentsUrl: item.LrsUrl,
+	}
+
+	if story.Url == "" {
+		story.Url = item.LrsUrl
+		story.Domain = "lobste.rs"
+	} else {
+		story.Domain = urlToDomain(story.Url)
+	}
+	story.DomainUrl = lrsUrl + "/domain/" + story.Domain
+
+	layout := "2006-01-02T15:04:05.999999999Z07:00"
+	t, err := time.Parse(layout, item.TimeS)
+	if err != nil {
+		return newsStory{}, err
+	}
+
+	story.Time = t.In(location)
+	story.Hours = int(now.Sub(story.Time).Hours())
+	if story.Hours > 0 {
+		story.ScoreAvg = story.Score / story.Hours
+	} else {
+		story.ScoreAvg = story.Score
+	}
+
+	return story, nil
+}
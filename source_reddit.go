@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redditSource reads listings of subreddits set with 'reddit_subreddits' in
+// newsfilter.conf; 'reddit_listing' chooses between top (of the day) and hot
+// stories and 'reddit_url' can point to a local server with saved listings
+type redditSource struct {
+	baseUrl    string
+	listing    string
+	subreddits []string
+	stories    map[string]redditPost
+}
+
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Kind string     `json:"kind"`
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Url        string  `json:"url"`
+	Domain     string  `json:"domain"`
+	Author     string  `json:"author"`
+	Subreddit  string  `json:"subreddit"`
+	Permalink  string  `json:"permalink"`
+	Score      int     `json:"score"`
+	Comments   int     `json:"num_comments"`
+	CreatedUtc float64 `json:"created_utc"`
+	Over18     bool    `json:"over_18"`
+	IsSelf     bool    `json:"is_self"`
+	Flair      string  `json:"link_flair_text"`
+}
+
+func init() {
+	registerSource(&redditSource{})
+}
+
+func (*redditSource) Name() string {
+	return "reddit"
+}
+
+func (*redditSource) Title() string {
+	return "reddit"
+}
+
+func (*redditSource) Filters() []string {
+	return []string{"domains", "keywords", "tags"}
+}
+
+func (s *redditSource) Setup(progDir string, settings config) error {
+	s.baseUrl = strings.TrimSuffix(settings.value("reddit_url"), "/")
+	s.listing = settings.value("reddit_listing")
+	s.subreddits = settings.list("reddit_subreddits")
+
+	if s.listing != "top" && s.listing != "hot" {
+		return errors.New("reddit_listing must be 'top' or 'hot'")
+	}
+
+	return nil
+}
+
+// Candidates downloads the listings of all the subreddits; a subreddit that
+// can't be fetched, e.g. a private or banned one, is skipped with a warning,
+// so it doesn't stop the others; it's an error only if all of them fail
+func (s *redditSource) Candidates(f *fetcher) ([]string, error) {
+	var ids []string
+	var lastErr error
+	fetched := 0
+	s.stories = make(map[string]redditPost)
+
+	for _, sub := range s.subreddits {
+		var listing redditListing
+
+		url := s.baseUrl + "/r/" + sub + "/" + s.listing +
+			".json?limit=100"
+		if s.listing == "top" {
+			url += "&t=day"
+		}
+
+		err := f.getJSON(url, &listing)
+		if err != nil {
+			log.Printf("warning: skipping subreddit %s: %v\n", sub, err)
+			lastErr = err
+			continue
+		}
+		fetched++
+
+		for _, child := range listing.Data.Children {
+			post := child.Data
+			if child.Kind != "t3" || post.ID == "" {
+				continue
+			}
+			if _, ok := s.stories[post.ID]; !ok {
+				ids = append(ids, post.ID)
+			}
+			s.stories[post.ID] = post
+		}
+	}
+	sort.Strings(ids)
+
+	if fetched == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return ids, nil
+}
+
+func (s *redditSource) Story(f *fetcher, id string,
+	now time.Time) (newsStory, error) {
+
+	post, ok := s.stories[id]
+	if !ok {
+		return newsStory{}, errors.New("reddit post not listed: " + id)
+	}
+
+	story := newsStory{
+		Source:      "reddit",
+		ID:          id,
+		By:          oneLine(post.Author),
+		Score:       post.Score,
+		Comments:    post.Comments,
+		Title:       oneLine(post.Title),
+		Url:         post.Url,
+		Tags:        []string{post.Subreddit},
+		CommentsUrl: s.baseUrl + post.Permalink,
+		DomainUrl:   s.baseUrl + "/domain/" + post.Domain,
+	}
+
+	if strings.HasPrefix(story.Url, "/") {
+		story.Url = s.baseUrl + story.Url
+	}
+	if story.Url == "" {
+		story.Url = story.CommentsUrl
+	}
+	// self posts have domains like self.programming, other posts get
+	// the same domains as stories of other sources
+	if post.IsSelf && post.Domain != "" {
+		story.Domain = post.Domain
+	} else {
+		story.Domain = urlToDomain(story.Url)
+	}
+	if post.Domain == "" {
+		story.DomainUrl = s.baseUrl + "/domain/" + story.Domain
+	}
+	if post.Flair != "" {
+		story.Tags = append(story.Tags, oneLine(post.Flair))
+	}
+
+	story.Time = time.Unix(int64(post.CreatedUtc), 0).In(location)
+	story.Hours = int(now.Sub(story.Time).Hours())
+	if story.Hours == 0 {
+		story.Hours = 1
+	}
+	story.ScoreAvg = story.Score / story.Hours
+
+	if post.Over18 {
+		story.Reason = reason{bucket: "blocked", pattern: "over_18"}
+	}
+
+	return story, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// reportStats is the 'stats' command: the number of logged stories in every
+// bucket of the enabled sources, or per-submitter stats with 'stats users'
+func reportStats(c cli, args []string) {
+	if len(args) > 0 && args[0] == "users" {
+		reportUsers(c.progDir, args[1:])
+		return
+	}
+
+	fmt.Printf("%-10s %8s %8s %8s %8s %10s %8s\n", "source", "main",
+		"blocked", "permalow", "low", "processed", "pending")
+	for _, source := range c.settings.sources() {
+		name := source.Name()
+		fmt.Printf("%-10s %8d %8d %8d %8d %10d %8d\n", name,
+			countLines(c.progDir+name+"_main.tsv"),
+			countLines(c.progDir+name+"_blocked.tsv"),
+			countLines(c.progDir+name+"_permalow.tsv"),
+			countLines(c.progDir+name+"_low.tsv.tmp"),
+			countLines(c.progDir+name+"_processed_ids"),
+			len(readPending(c.progDir, name)))
+	}
+}
+
+// countLines returns the number of lines of a file, 0 if it doesn't exist
+func countLines(file string) int {
+	fd, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	errExit(err, "error: cannot read file")
+	defer fd.Close()
+
+	n := 0
+	input := bufio.NewScanner(fd)
+	input.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for input.Scan() {
+		n++
+	}
+	errExit(input.Err(), "error: cannot read file")
+
+	return n
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// userStats sums up all the logged stories of a single HN submitter
+type userStats struct {
+	user     string
+	main     int
+	blocked  int
+	permaLow int
+	scores   []int
+}
+
+// readBlockedUsers reads HN usernames to block, one per line; the file is
+// optional
+func readBlockedUsers(file string) []listEntry {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	return readList(file)
+}
+
+func blockUser(users []listEntry, user string) (bool, reason) {
+	for _, entry := range users {
+		u := strings.TrimSpace(entry.text)
+		if u == "" || strings.HasPrefix(u, "#") {
+			continue
+		}
+
+		if u == user {
+			return true, reason{file: "blocked.users",
+				line: entry.line, pattern: u}
+		}
+	}
+	return false, reason{}
+}
+
+// reportUsers prints per-submitter stats from the HN logs; args can hold
+// the minimal number of stories a user must have to be listed
+func reportUsers(progDir string, args []string) {
+	minStories := 3
+	if len(args) > 0 {
+		var err error
+		minStories, err = strconv.Atoi(args[0])
+		if err == nil && minStories < 1 {
+			err = errors.New(args[0])
+		}
+		errExit(err, "error: incorrect minimal number of stories")
+	}
+
+	stats := make(map[string]*userStats)
+	add := func(file string, count func(*userStats)) {
+		for _, story := range readLog(progDir, "hn", file) {
+			s, ok := stats[story.By]
+			if !ok {
+				s = &userStats{user: story.By}
+				stats[story.By] = s
+			}
+			count(s)
+			s.scores = append(s.scores, story.Score)
+		}
+	}
+
+	add("hn_main.tsv", func(s *userStats) { s.main++ })
+	add("hn_blocked.tsv", func(s *userStats) { s.blocked++ })
+	add("hn_permalow.tsv", func(s *userStats) { s.permaLow++ })
+
+	var users []*userStats
+	for _, s := range stats {
+		if s.total() >= minStories {
+			users = append(users, s)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		ri, rj := users[i].blockRatio(), users[j].blockRatio()
+		if ri != rj {
+			return ri > rj
+		}
+		if users[i].total() != users[j].total() {
+			return users[i].total() > users[j].total()
+		}
+		return users[i].user < users[j].user
+	})
+
+	fmt.Printf("%-20s %6s %6s %8s %8s %7s %8s\n", "user", "total",
+		"main", "blocked", "permalow", "blocked%", "median")
+	for _, s := range users {
+		fmt.Printf("%-20s %6d %6d %8d %8d %7.1f%% %8d\n", s.user,
+			s.total(), s.main, s.blocked, s.permaLow,
+			s.blockRatio()*100, s.medianScore())
+	}
+}
+
+func (s *userStats) total() int {
+	return s.main + s.blocked + s.permaLow
+}
+
+func (s *userStats) blockRatio() float64 {
+	return float64(s.blocked) / float64(s.total())
+}
+
+func (s *userStats) medianScore() int {
+	scores := append([]int{}, s.scores...)
+	sort.Ints(scores)
+
+	n := len(scores)
+	if n%2 == 1 {
+		return scores[n/2]
+	}
+	return (scores[n/2-1] + scores[n/2]) / 2
+}